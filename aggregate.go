@@ -0,0 +1,231 @@
+package ngago
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego/orm"
+)
+
+var aggregateExpr = regexp.MustCompile(`(?i)^\s*(count|sum|avg|min|max)\s*\(\s*(\*|[\w.]+)\s*\)\s*$`)
+
+type aggregate struct {
+	fn    string
+	field string
+	index int
+}
+
+func parseAggregates(exprs map[string]string) (map[string]*aggregate, []string, error) {
+	aggs := make(map[string]*aggregate, len(exprs))
+	var fields []string
+	indexes := make(map[string]int)
+	for key, expr := range exprs {
+		m := aggregateExpr.FindStringSubmatch(expr)
+		if m == nil || (m[2] == "*" && strings.ToLower(m[1]) != "count") {
+			return nil, nil, fmt.Errorf("invalid aggregate expression for %s: %q", key, expr)
+		}
+		agg := &aggregate{fn: strings.ToLower(m[1]), field: strings.Replace(m[2], ".", "__", -1), index: -1}
+		if agg.field != "*" {
+			i, ok := indexes[agg.field]
+			if !ok {
+				i = len(fields)
+				indexes[agg.field] = i
+				fields = append(fields, agg.field)
+			}
+			agg.index = i
+		}
+		aggs[key] = agg
+	}
+	return aggs, fields, nil
+}
+
+type accumulator struct {
+	agg   *aggregate
+	count int64
+	isInt bool
+	sumI  int64
+	sumF  float64
+	value interface{}
+}
+
+func newAccumulator(agg *aggregate) *accumulator {
+	return &accumulator{agg: agg, isInt: true}
+}
+
+func (a *accumulator) add(row orm.ParamsList) {
+	if a.agg.index < 0 {
+		a.count++
+		return
+	}
+	v := row[a.agg.index]
+	if v == nil {
+		return
+	}
+	a.count++
+	switch a.agg.fn {
+	case "sum", "avg":
+		if i, ok := v.(int64); ok && a.isInt {
+			a.sumI += i
+			return
+		}
+		f, ok := toFloat(v)
+		if !ok {
+			return
+		}
+		if a.isInt {
+			a.isInt = false
+			a.sumF = float64(a.sumI)
+		}
+		a.sumF += f
+	case "min", "max":
+		if a.value == nil {
+			a.value = v
+			return
+		}
+		c, ok := compareValues(v, a.value)
+		if ok && ((a.agg.fn == "min" && c < 0) || (a.agg.fn == "max" && c > 0)) {
+			a.value = v
+		}
+	}
+}
+
+func (a *accumulator) result() interface{} {
+	switch a.agg.fn {
+	case "count":
+		return a.count
+	case "sum":
+		if a.isInt {
+			return a.sumI
+		}
+		return a.sumF
+	case "avg":
+		if a.count == 0 {
+			return nil
+		}
+		if a.isInt {
+			return float64(a.sumI) / float64(a.count)
+		}
+		return a.sumF / float64(a.count)
+	}
+	return a.value
+}
+
+// aggregateGroup accumulates the aggregates of the rows with the same values for the fields grouped by
+type aggregateGroup struct {
+	values orm.ParamsList
+	accs   map[string]*accumulator
+}
+
+func newAggregateGroup(values orm.ParamsList, aggs map[string]*aggregate) *aggregateGroup {
+	g := &aggregateGroup{values: values, accs: make(map[string]*accumulator, len(aggs))}
+	for key, agg := range aggs {
+		g.accs[key] = newAccumulator(agg)
+	}
+	return g
+}
+
+func (g *aggregateGroup) result(groupBy []string) map[string]interface{} {
+	result := make(map[string]interface{}, len(groupBy)+len(g.accs))
+	for i, f := range groupBy {
+		result[f] = g.values[i]
+	}
+	for key, acc := range g.accs {
+		result[key] = acc.result()
+	}
+	return result
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func compareValues(a, b interface{}) (int, bool) {
+	if ta, ok := a.(time.Time); ok {
+		tb, ok := b.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case ta.Before(tb):
+			return -1, true
+		case ta.After(tb):
+			return 1, true
+		}
+		return 0, true
+	}
+	if sa, ok := a.(string); ok {
+		sb, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(sa, sb), true
+	}
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	switch {
+	case fa < fb:
+		return -1, true
+	case fa > fb:
+		return 1, true
+	}
+	return 0, true
+}
+
+// matchAggregate compares the result of an aggregate with a filter value, using the orm operator op
+func matchAggregate(result interface{}, op string, value interface{}) (bool, error) {
+	if op == "isnull" {
+		isNull, err := FieldBool.Parse(value)
+		if err != nil {
+			return false, err
+		}
+		return (result == nil) == isNull.(bool), nil
+	}
+	if _, ok := result.(time.Time); ok {
+		d, err := FieldDate.Parse(value)
+		if err != nil {
+			return false, err
+		}
+		value = d
+	} else if _, ok := value.(time.Time); !ok {
+		f, err := FieldFloat.Parse(value)
+		if err != nil {
+			return false, err
+		}
+		value = f
+	}
+	if result == nil {
+		return false, nil
+	}
+	c, ok := compareValues(result, value)
+	if !ok {
+		return false, nil
+	}
+	switch op {
+	case "", "exact":
+		return c == 0, nil
+	case "gt":
+		return c > 0, nil
+	case "gte":
+		return c >= 0, nil
+	case "lt":
+		return c < 0, nil
+	case "lte":
+		return c <= 0, nil
+	}
+	return false, fmt.Errorf("operator %s not supported", op)
+}
@@ -0,0 +1,109 @@
+package ngago
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/astaxie/beego"
+)
+
+func init() {
+	beego.Router("/books/_summary", &BookController{}, "get:Summary")
+	beego.Router("/books/_aggregate", &BookController{}, "get:Aggregate")
+}
+
+func TestSummary(t *testing.T) {
+	resetBooks(t)
+	r := NewRepository("book", Book{})
+	fields := map[string]string{"books": "count(*)", "pages": "sum(Pages)", "average": "avg(Pages)", "longest": "max(Pages)"}
+	summary, err := r.Summary(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary["books"] != int64(3) || summary["pages"] != int64(1087) || summary["longest"] != int64(412) {
+		t.Errorf("expected 3 books with 1087 pages, the longest with 412, got %v", summary)
+	}
+	if average, _ := summary["average"].(float64); int(average) != 362 {
+		t.Errorf("expected an average of 362.33 pages, got %v", summary["average"])
+	}
+	summary, err = r.Summary(fields, QueryOptions{Filters: map[string]interface{}{"Available": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary["books"] != int64(2) || summary["pages"] != int64(722) {
+		t.Errorf("expected 2 available books with 722 pages, got %v", summary)
+	}
+	if _, err := r.Summary(map[string]string{"pages": "sum(*)"}); err == nil {
+		t.Error("expected an error for sum(*)")
+	}
+}
+
+func TestSummaryRoute(t *testing.T) {
+	resetBooks(t)
+	w := request("GET", "/books/_summary?author=2&_summary="+url.QueryEscape(`{"books":"count(*)","pages":"sum(Pages)"}`), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var summary map[string]int64
+	if err := json.Unmarshal(w.Body.Bytes(), &summary); err != nil || summary["books"] != 1 || summary["pages"] != 412 {
+		t.Errorf("expected the summary of Dune, got %s", w.Body.String())
+	}
+	for _, spec := range []string{"", "{}", `{"pages":"total(Pages)"}`} {
+		if w := request("GET", "/books/_summary?_summary="+url.QueryEscape(spec), ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", spec, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	resetBooks(t)
+	r := NewRepository("book", Book{})
+	results, err := r.Aggregate([]string{"Author.Name"}, map[string]string{"books": "count(*)", "pages": "sum(Pages)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sorted by the values of the groups
+	expected := []struct {
+		author string
+		books  int64
+		pages  int64
+	}{{"Herbert", 1, 412}, {"Tolkien", 2, 675}}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d groups, got %v", len(expected), results)
+	}
+	for i, e := range expected {
+		if results[i]["Author.Name"] != e.author || results[i]["books"] != e.books || results[i]["pages"] != e.pages {
+			t.Errorf("expected %+v, got %v", e, results[i])
+		}
+	}
+	results, err = r.Aggregate([]string{"Available"}, map[string]string{"books": "count(*)"},
+		QueryOptions{Filters: map[string]interface{}{"Pages": "999"}})
+	if err != nil || len(results) != 0 {
+		t.Errorf("expected no groups when no book matches, got %v, %v", results, err)
+	}
+	for _, groupBy := range [][]string{nil, {"Unknown"}, {"Author.Books"}} {
+		if _, err := r.Aggregate(groupBy, map[string]string{"books": "count(*)"}); err == nil {
+			t.Errorf("%v: expected an error", groupBy)
+		}
+	}
+}
+
+func TestAggregateRoute(t *testing.T) {
+	resetBooks(t)
+	w := request("GET", "/books/_aggregate?_groupBy=author&_aggregates="+url.QueryEscape(`{"longest":"max(Pages)"}`), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var results []map[string]int64
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil || len(results) != 2 ||
+		results[0]["author"] != 1 || results[0]["longest"] != 365 || results[1]["longest"] != 412 {
+		t.Errorf("expected the longest book of each author, got %s", w.Body.String())
+	}
+	for _, query := range []string{"_aggregates={}", "_groupBy=Unknown&_aggregates=" + url.QueryEscape(`{"books":"count(*)"}`)} {
+		if w := request("GET", "/books/_aggregate?"+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", query, w.Code, w.Body.String())
+		}
+	}
+}
@@ -1,31 +1,114 @@
 package ngago
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/astaxie/beego/orm"
 )
 
 var ErrNotFound = orm.ErrNoRows
 
+// ErrGone can be returned by Read for entities that existed but were deleted, ex: soft-deleted rows
+// kept in the table, so a direct GET responds with 410 (Gone) instead of 404
+var ErrGone = errors.New("ngago: entity was deleted")
+
+// OrFilter is the filter key for a group of alternative filters. See BuildFilterCondition
+const OrFilter = "_or"
+
+// ErrNoIds is returned by the operations on many entities when no id is given
+var ErrNoIds = errors.New("ngago: no ids given")
+
+// FilterError is returned by ValidateOptions when a filter references an unknown field
+type FilterError struct {
+	Field string
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("unknown filter field %q", e.Field)
+}
+
+// SortError is returned by ValidateOptions when a sort field is not allowed by AllowSort
+type SortError struct {
+	Field string
+}
+
+func (e *SortError) Error() string {
+	return fmt.Sprintf("sort field %q is not allowed", e.Field)
+}
+
+const DefaultChunkSize = 100
+
+const defaultAlias = "default"
+
+// nullsDirective matches a nulls ordering suffix in a sort field, ex: "name nulls last"
+var nullsDirective = regexp.MustCompile(`(?i)\s+nulls\s+(first|last)$`)
+
 type QueryOptions struct {
 	Sort    string
 	Order   string
+	Nulls   string // Nulls ordering for all sort fields: "first", "last" or "" for the database default
 	Offset  int
 	Max     int
 	Filters map[string]interface{}
+	Fields  []string // Fields requested by the client. Only these columns and the relations referenced here are loaded
+	Deleted DeletedScope
+	Search  string // Text searched in the fields declared with SearchFields
+	After   string // Cursor of the last entity read, for keyset pagination. See CursorPaginator
+}
+
+/*
+DeletedScope selects which entities are read from repositories that soft-delete entities: only the
+active ones (the default), only the deleted ones, or all of them. BaseRepository honors it when
+configured with SoftDelete, other repositories implementing soft-deletion can honor it in
+BuildFilterCondition
+*/
+type DeletedScope int
+
+const (
+	ScopeActive DeletedScope = iota
+	ScopeDeleted
+	ScopeAll
+)
+
+func (s DeletedScope) String() string {
+	switch s {
+	case ScopeDeleted:
+		return "deleted"
+	case ScopeAll:
+		return "all"
+	}
+	return "active"
+}
+
+// ParseDeletedScope converts "active", "deleted" or "all" to a DeletedScope
+func ParseDeletedScope(value string) (DeletedScope, error) {
+	for _, s := range []DeletedScope{ScopeActive, ScopeDeleted, ScopeAll} {
+		if strings.EqualFold(value, s.String()) {
+			return s, nil
+		}
+	}
+	return ScopeActive, fmt.Errorf("invalid deleted scope %q", value)
 }
 
 type Repository interface {
 	// These methods are provided by the BaseRepository struct
 	Count(options ...QueryOptions) (int64, error)
-	Read(id int64, data interface{}) error
+	// Ids are values of the primary key field, returned by IdField, ex: an int64 or a UUID string
+	Read(id interface{}, data interface{}) error
 	ReadAll(dataSet interface{}, options ...QueryOptions) error
 	Save(p interface{}) (int64, error)
 	Update(p interface{}, cols ...string) error
-	Delete(id int64) error
+	Delete(id interface{}) error
+	IdField() string
 	EntityName() string
 	NewSlice() interface{}
 	NewInstance() interface{}
@@ -34,37 +117,467 @@ type Repository interface {
 	// These methods can be overriden by subclasses to manipulate the queries used by Read and ReadAll
 	One(qs orm.QuerySeter, data interface{}) error
 	All(qs orm.QuerySeter, dataSet interface{}) (int64, error)
+	// PrepareQuery is called for every query used by Read, ReadAll and Count, after the filters and
+	// options are applied and right before it is executed
+	PrepareQuery(qs orm.QuerySeter) orm.QuerySeter
+	// BuildFilterCondition assembles the condition used for the filters of the options
+	BuildFilterCondition(options QueryOptions) *orm.Condition
+}
+
+// PageResult is a page of entities along with its pagination information, as returned by Paginate
+type PageResult struct {
+	Items      interface{} `json:"items"`
+	Total      int64       `json:"total"`
+	Page       int         `json:"page"`
+	PerPage    int         `json:"perPage"`
+	TotalPages int64       `json:"totalPages"`
+}
+
+// totalPages computes the number of pages needed for total entities. Without a page size, all entities
+// are in a single page
+func totalPages(total int64, perPage int) int64 {
+	if total == 0 {
+		return 0
+	}
+	if perPage <= 0 {
+		return 1
+	}
+	return (total + int64(perPage) - 1) / int64(perPage)
+}
+
+// OptionsValidator is implemented by repositories that can check QueryOptions before running a query
+type OptionsValidator interface {
+	ValidateOptions(options QueryOptions) error
 }
 
+// WarningReporter is implemented by repositories that report the parts of the QueryOptions they could
+// not honor, as BaseRepository does. The warnings accumulate for the lifetime of the repository
+type WarningReporter interface {
+	Warnings() []string
+}
+
+// ColumnMapper is implemented by repositories that can map the JSON keys of their entities to the orm
+// columns, as BaseRepository does
+type ColumnMapper interface {
+	Columns(jsonKeys ...string) []string
+}
+
+// BulkUpdater is implemented by repositories that can update many entities at once, as BaseRepository does
+type BulkUpdater interface {
+	UpdateMany(ids []interface{}, changes map[string]interface{}) (int64, error)
+}
+
+// BulkDeleter is implemented by repositories that can delete many entities at once, as BaseRepository does
+type BulkDeleter interface {
+	DeleteMany(ids []interface{}) (int64, error)
+}
+
+// Upserter is implemented by repositories that can create or update an entity in a single call, as
+// BaseRepository does
+type Upserter interface {
+	Upsert(p interface{}) (int64, error)
+}
+
+// ExistenceChecker is implemented by repositories that can tell if entities exist without reading them, as
+// BaseRepository does
+type ExistenceChecker interface {
+	Exists(id interface{}) (bool, error)
+	ExistsBy(field string, value interface{}) (bool, error)
+}
+
+// ManyReader is implemented by repositories that can read many entities by their ids at once, as
+// BaseRepository does
+type ManyReader interface {
+	ReadMany(ids []interface{}, dataSet interface{}) error
+}
+
+// Summarizer is implemented by repositories that can compute aggregates, as BaseRepository does
+type Summarizer interface {
+	Summary(fields map[string]string, options ...QueryOptions) (map[string]interface{}, error)
+}
+
+// Aggregator is implemented by repositories that can compute aggregates by groups, as BaseRepository does
+type Aggregator interface {
+	Aggregate(groupBy []string, aggregates map[string]string, options ...QueryOptions) ([]map[string]interface{}, error)
+}
+
+// DistinctReader is implemented by repositories that can list the distinct values of a field, as
+// BaseRepository does
+type DistinctReader interface {
+	Distinct(field string, options ...QueryOptions) ([]interface{}, error)
+}
+
+// MaxDistinctValues is the largest number of values returned by Distinct
+var MaxDistinctValues = 1000
+
 type FilterFunc func(qs orm.QuerySeter, field, value string) orm.QuerySeter
 
+// OperatorFilterFunc is a FilterFunc that also receives the operator of the filter key, ex: "gte" for
+// price_gte, or "" when the key has none. See AddOperatorFilter
+type OperatorFilterFunc func(qs orm.QuerySeter, field, op, value string) orm.QuerySeter
+
 type BaseRepository struct {
 	Orm orm.Ormer
 
 	self         Repository
 	table        string
 	filterMap    map[string]FilterFunc
+	opFilterMap  map[string]OperatorFilterFunc
+	fieldTypes   map[string]FieldType
+	enumValues   map[string][]string
+	operators    OperatorConvention
+	allowedOps   map[string]bool
 	instanceType reflect.Type
 	sliceType    reflect.Type
+	idField      entityField
+	related      []string
+	columns      []string
+	warnings     []string
+	annotations  map[string]*aggregate
+	denied       []string
+	prefetch     []string
+	softDelete   string
+	defaultFunc  FilterFunc
+	searchFields []string
+	allowedSort  []string
+	allowedKeys  []string
+	versionField string
+	lockField    entityField
+	ctx          context.Context
+	keyFields    []entityField
+	scopes       []ScopeFunc
+	tenants      []tenantValue
+	logger       Logger
 }
 
 func (r *BaseRepository) Init(table string, instance interface{}, ormer ...orm.Ormer) {
 	r.self = r
 	r.table = table
 	r.filterMap = make(map[string]FilterFunc)
-	r.instanceType = reflect.TypeOf(instance)
+	r.opFilterMap = make(map[string]OperatorFilterFunc)
+	r.fieldTypes = make(map[string]FieldType)
+	r.enumValues = make(map[string][]string)
+	r.annotations = make(map[string]*aggregate)
+	r.instanceType = indirectType(reflect.TypeOf(instance))
 	r.sliceType = reflect.SliceOf(r.instanceType)
+	r.idField = primaryKey(r.instanceType)
 	if len(ormer) > 0 {
 		r.Orm = ormer[0]
 	} else {
+		if _, err := orm.GetDB(defaultAlias); err != nil {
+			panic(fmt.Sprintf("ngago: cannot create repository for %s, database alias %q is not registered. "+
+				"Call orm.RegisterDataBase(%q, ...) before initializing repositories", table, defaultAlias, defaultAlias))
+		}
 		r.Orm = orm.NewOrm()
 	}
 }
 
+type binder interface {
+	bind(self Repository)
+}
+
+/*
+bind sets the repository used to dispatch the overridable methods (One, All and PrepareQuery), so the
+overrides of a subclass embedding BaseRepository are honored. It's called by BaseRESTController with
+the repository returned by NewRepo
+*/
+func (r *BaseRepository) bind(self Repository) {
+	r.self = self
+}
+
 func (r *BaseRepository) AddFilter(field string, function FilterFunc) {
 	r.filterMap[field] = function
 }
 
+/*
+AddOperatorFilter registers a function for all the filters of a field, with or without an operator, ex: for
+"price", the function is called for price=10, price_gte=10 and price_between=10,20, with the operators "",
+"gte" and "between", to normalize the values of a currency field before comparing them. The operators are
+the ones of the RangeSuffixes, IntervalSuffixes and NullSuffix, and of the OperatorConvention, when set and
+allowed. The function replaces the handling of all of them: the values it receives are the raw strings,
+ex: "10,20" for _between, lists are joined with commas, and dates and intervals are not parsed. The field
+doesn't need to be a field of the entity. Filters registered with AddFilter for the whole key, ex:
+"price_gte", take precedence
+*/
+func (r *BaseRepository) AddOperatorFilter(field string, function OperatorFilterFunc) {
+	r.opFilterMap[field] = function
+}
+
+// operatorFilter returns the OperatorFilterFunc registered for the field of a filter key, along with the
+// field and the operator of the key
+func (r *BaseRepository) operatorFilter(key string) (OperatorFilterFunc, string, string, bool) {
+	if _, ok := r.filterMap[key]; ok {
+		return nil, "", "", false
+	}
+	if ff, ok := r.opFilterMap[key]; ok {
+		return ff, key, "", true
+	}
+	if r.operators != nil {
+		if field, op, ok := r.operators(key); ok && r.allowedOps[strings.ToLower(op)] {
+			if ff, ok := r.opFilterMap[field]; ok {
+				return ff, field, strings.ToLower(op), true
+			}
+		}
+	}
+	if field, op, ok := defaultOperator(key); ok {
+		if ff, ok := r.opFilterMap[field]; ok {
+			return ff, field, op, true
+		}
+	}
+	return nil, "", "", false
+}
+
+// SetDefaultFilter changes the FilterFunc used for the plain fields without a filter registered with
+// AddFilter, ex: ExactFilter for tables of codes. When not set, it's StartsWithFilter
+func (r *BaseRepository) SetDefaultFilter(function FilterFunc) {
+	r.defaultFunc = function
+}
+
+/*
+SetOperatorConvention enables operator suffixes in filter keys, using the given convention, ex: with
+UnderscoreOperators, price_gte=10 filters by price greater than or equal to 10. Only the allowed
+operators are recognized, or SafeOperators when none is specified. The value of an "in" filter is a
+comma separated list, and the value of an "isnull" filter is a boolean. Filters registered with
+AddFilter for the whole key, ex: "price_gte", take precedence over the convention.
+*/
+func (r *BaseRepository) SetOperatorConvention(convention OperatorConvention, allowed ...string) {
+	if len(allowed) == 0 {
+		allowed = SafeOperators
+	}
+	r.operators = convention
+	r.allowedOps = make(map[string]bool, len(allowed))
+	for _, op := range allowed {
+		r.allowedOps[strings.ToLower(op)] = true
+	}
+}
+
+/*
+DenyFilters declares fields that can never be filtered, even though they are columns of the entity, ex:
+"PasswordHash", as filtering by them would allow clients to guess their values. Fields of relations are
+declared with a dotted path, ex: "Author.PasswordHash". ValidateOptions rejects filters referencing them
+with the same *FilterError returned for unknown fields, and they are dropped from the queries.
+*/
+func (r *BaseRepository) DenyFilters(fields ...string) {
+	for _, f := range fields {
+		r.denied = append(r.denied, r.fieldPath(f))
+	}
+}
+
+/*
+AllowFilters restricts the filters accepted to the ones referencing the given fields, ex: "Name",
+"Author.Name", or registered with AddFilter under the given keys. Operator suffixes of the allowed
+fields are accepted too, ex: "price_gte" when "Price" is allowed. ValidateOptions rejects any other
+filter with a *FilterError, and they are dropped from the queries. When not called, all filters are
+accepted
+*/
+func (r *BaseRepository) AllowFilters(fields ...string) {
+	for _, f := range fields {
+		r.allowedKeys = append(r.allowedKeys, r.fieldPath(f))
+	}
+}
+
+/*
+AllowSort restricts the sort fields accepted to the given ones, ex: "Name", "Author.Name".
+ValidateOptions rejects any other sort field with a *SortError, and they are dropped from the queries.
+When not called, all fields of the entity are accepted
+*/
+func (r *BaseRepository) AllowSort(fields ...string) {
+	for _, f := range fields {
+		r.allowedSort = append(r.allowedSort, r.fieldPath(f))
+	}
+}
+
+// fieldPath normalizes a dotted field path to the names of the fields it references, separated by "__"
+// and lowercased, ex: "author.name" -> "author__name", or just lowercases it if it isn't a field path
+func (r *BaseRepository) fieldPath(f string) string {
+	path := strings.Replace(f, ".", "__", -1)
+	if names := fieldNames(r.instanceType, path); len(names) == len(strings.Split(path, "__")) {
+		path = strings.Join(names, "__")
+	}
+	return strings.ToLower(path)
+}
+
+// isFilterAllowed tells if a filter key is accepted by AllowFilters
+func (r *BaseRepository) isFilterAllowed(key string) bool {
+	if r.allowedKeys == nil {
+		return true
+	}
+	field, _ := r.parseOperator(key)
+	for _, path := range []string{key, field, strings.TrimSuffix(field, "Id")} {
+		if inPaths(r.allowedKeys, r.fieldPath(path)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSortAllowed tells if a sort field, without its direction, is accepted by AllowSort
+func (r *BaseRepository) isSortAllowed(field string) bool {
+	return r.allowedSort == nil || inPaths(r.allowedSort, r.fieldPath(field))
+}
+
+func inPaths(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// isDenied tells if a filter key references a field declared with DenyFilters
+func (r *BaseRepository) isDenied(key string) bool {
+	if len(r.denied) == 0 {
+		return false
+	}
+	field, _ := r.parseOperator(key)
+	for _, path := range []string{field, key} {
+		path = strings.Replace(path, ".", "__", -1)
+		names := fieldNames(r.instanceType, path)
+		for _, d := range r.denied {
+			if strings.EqualFold(path, d) {
+				return true
+			}
+			for i := range names {
+				if strings.EqualFold(strings.Join(names[:i+1], "__"), d) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+/*
+AddTypedFilter declares the type of a filterable field, so its filter values are coerced to that type
+before querying, ex: an int field accepts 5, "5" and 5.0, and a bool field accepts true, "true" and 1.
+Values that can't be coerced are ignored. FieldEnum fields accept any string, unless their values are
+declared with AddEnumFilter. Fields declared with a type other than FieldString are matched exactly,
+unless a FilterFunc is also registered for them with AddFilter, in which case the FilterFunc receives
+the coerced value formatted as a string.
+*/
+func (r *BaseRepository) AddTypedFilter(field string, fieldType FieldType) {
+	r.fieldTypes[field] = fieldType
+}
+
+// AddEnumFilter declares a FieldEnum filter accepting only the given values, matched case-insensitively and
+// converted to the declared case, ex: AddEnumFilter("status", "new", "shipped") accepts status=Shipped
+func (r *BaseRepository) AddEnumFilter(field string, values ...string) {
+	r.fieldTypes[field] = FieldEnum
+	r.enumValues[field] = values
+}
+
+/*
+AddExistsFilter registers a filter that selects the entities having (value "true") or not having
+(value "false") at least one related row through the relation path, ex: "Orders" or "Orders.Items".
+Optional conditions are applied to the related rows, so "has_shipped_orders" can be registered with
+orm.NewCondition().And("Orders__Status", "shipped").
+
+The matching ids are resolved with a separate query and applied as an Id__in filter, so the
+entities are not duplicated by the join.
+*/
+func (r *BaseRepository) AddExistsFilter(field, relation string, conds ...*orm.Condition) {
+	relation = strings.Replace(relation, ".", "__", -1)
+	r.AddFilter(field, func(qs orm.QuerySeter, _, value string) orm.QuerySeter {
+		exists, err := strconv.ParseBool(value)
+		if err != nil {
+			r.warn(fmt.Sprintf("Invalid value for filter %s - %s", field, value))
+			return qs
+		}
+		related := r.query(r.Orm)
+		if len(conds) > 0 {
+			cond := orm.NewCondition()
+			for _, c := range conds {
+				cond = cond.AndCond(c)
+			}
+			related = related.SetCond(cond)
+		}
+		var ids orm.ParamsList
+		if _, err := related.Filter(relation+"__isnull", false).Distinct().ValuesFlat(&ids, r.idField.Name); err != nil {
+			r.log().Error("Error resolving filter", field, "-", err.Error())
+			r.warn(fmt.Sprintf("Filter %s ignored", field))
+			return qs
+		}
+		switch {
+		case len(ids) > 0 && exists:
+			return qs.Filter(r.idField.Name+"__in", ids...)
+		case len(ids) > 0:
+			return qs.Exclude(r.idField.Name+"__in", ids...)
+		case exists:
+			return qs.Filter(r.idField.Name+"__isnull", true)
+		}
+		return qs
+	})
+}
+
+/*
+AddAnnotation declares a computed field, name, as an aggregate over a relation of the entity, so it can
+be used in filters, ex: with AddAnnotation("postCount", "count(Posts)"), postCount__gte=5 selects the
+authors with at least 5 posts. The expression is one of count, sum, avg, min or max applied to a relation
+or to a field of a relation, ex: "sum(Orders.Amount)". Annotation filters accept the exact, gt, gte, lt,
+lte and isnull operators, either as an orm suffix (postCount__gte) or using the operator convention.
+
+The orm has no support for GROUP BY/HAVING clauses, so the aggregates are computed by the application,
+reading the related column of all entities, and the matching ids are applied as an Id__in filter.
+*/
+func (r *BaseRepository) AddAnnotation(name, expr string) {
+	aggs, columns, err := parseAggregates(map[string]string{name: expr})
+	if err != nil || len(columns) == 0 {
+		panic(fmt.Sprintf("ngago: invalid annotation %s for %s: %q", name, r.table, expr))
+	}
+	agg := aggs[name]
+	agg.index = 1
+	r.annotations[name] = agg
+}
+
+/*
+SoftDelete makes Delete set the field, a timestamp declared with orm:"null", to the current time instead
+of deleting the row, ex: SoftDelete("DeletedAt"). The entities with the field set are then excluded from
+ReadAll, Count and all other queries with filters, unless requested with the Deleted option, and Read
+returns ErrGone for them.
+*/
+func (r *BaseRepository) SoftDelete(field string) {
+	f, ok := findField(r.instanceType, field)
+	if !ok {
+		panic(fmt.Sprintf("ngago: invalid soft delete field %s for %s", field, r.table))
+	}
+	r.softDelete = f.Name
+}
+
+/*
+SetIdField changes the field used as the id of the entities, ex: SetIdField("Code"). By default it's the
+primary key of the entity, as the orm determines it: the field tagged with orm:"pk", or else the Id field
+*/
+func (r *BaseRepository) SetIdField(field string) {
+	f, ok := findField(r.instanceType, field)
+	if !ok {
+		panic(fmt.Sprintf("ngago: invalid id field %s for %s", field, r.table))
+	}
+	r.idField = f
+}
+
+/*
+SearchFields declares the fields matched by the Search option, ex: SearchFields("Name", "Email",
+"Author.Name"). Clients search with the _q param. Entities match when any of the fields contains the
+text, case insensitively, and the search is combined with the other filters. Fields of many-to-many or
+reverse many relations are not supported, as they would duplicate the entities
+*/
+func (r *BaseRepository) SearchFields(fields ...string) {
+	for _, f := range fields {
+		path := strings.Replace(f, ".", "__", -1)
+		if _, ok := resolveField(r.instanceType, path); !ok || isToMany(r.instanceType, path) {
+			panic(fmt.Sprintf("ngago: invalid search field %s for %s", f, r.table))
+		}
+		r.searchFields = append(r.searchFields, path)
+	}
+}
+
+// Columns maps JSON keys of the entity to the orm columns of the corresponding fields, as declared by
+// their json and orm tags, ex: to the columns of a partial Update. Unknown keys and the Id are skipped
+func (r *BaseRepository) Columns(jsonKeys ...string) []string {
+	return jsonColumns(r.instanceType, jsonKeys)
+}
+
 func (r *BaseRepository) NewInstance() interface{} {
 	return reflect.New(r.instanceType).Interface()
 }
@@ -77,124 +590,1458 @@ func (r *BaseRepository) NewSlice() interface{} {
 }
 
 func (r *BaseRepository) One(qs orm.QuerySeter, data interface{}) error {
-	return qs.RelatedSel().One(data)
+	return r.relatedSel(qs).One(data)
 }
 
 func (r *BaseRepository) All(qs orm.QuerySeter, dataSet interface{}) (int64, error) {
-	return qs.RelatedSel().All(dataSet)
+	return r.relatedSel(qs).All(dataSet, r.columns...)
+}
+
+// relatedSel loads the relations selected for the current query or configured with WithRelations, or all
+// of them when none was selected
+func (r *BaseRepository) relatedSel(qs orm.QuerySeter) orm.QuerySeter {
+	if r.related == nil {
+		return qs.RelatedSel()
+	}
+	if len(r.related) == 0 {
+		return qs
+	}
+	params := make([]interface{}, len(r.related))
+	for i, rel := range r.related {
+		params[i] = rel
+	}
+	return qs.RelatedSel(params...)
+}
+
+// PrepareQuery returns qs unchanged. Subclasses can override it to tweak all their queries, ex: adding
+// a Distinct() or restricting the selected relations
+func (r *BaseRepository) PrepareQuery(qs orm.QuerySeter) orm.QuerySeter {
+	return qs
 }
 
 func (r *BaseRepository) EntityName() string {
 	return r.table
 }
 
-func (r *BaseRepository) Read(id int64, data interface{}) error {
-	qs := r.Orm.QueryTable(r.table).Filter("Id", id)
-	err := r.self.One(qs, data)
-	return err
+// IdField returns the name of the entity's primary key field: the one tagged with orm:"pk", or Id
+func (r *BaseRepository) IdField() string {
+	return r.idField.Name
+}
+
+func (r *BaseRepository) Read(id interface{}, data interface{}) error {
+	if err := r.ctxErr(); err != nil {
+		return err
+	}
+	return r.readOne(r.query(r.Orm).Filter(r.idField.Name, id), data)
+}
+
+// readOne reads the single entity matched by qs, as Read does
+func (r *BaseRepository) readOne(qs orm.QuerySeter, data interface{}) error {
+	if err := r.self.One(r.self.PrepareQuery(qs), data); err != nil {
+		return err
+	}
+	if r.softDelete != "" && !isZero(reflect.Indirect(reflect.ValueOf(data)).FieldByName(r.softDelete)) {
+		return ErrGone
+	}
+	return r.loadPrefetched(data, r.prefetch)
+}
+
+/*
+Exists tells if there's an entity with the id, without reading it: no columns nor relations are loaded,
+ex: to check a foreign key in a Validate method. Soft-deleted entities don't exist
+*/
+func (r *BaseRepository) Exists(id interface{}) (bool, error) {
+	return r.ExistsBy(r.idField.Name, id)
+}
+
+// ExistsBy tells if there's an entity with the value in the field, referenced by name, column or JSON key,
+// as Exists does, ex: ExistsBy("Email", email). A nil value matches the entities with a null field
+func (r *BaseRepository) ExistsBy(field string, value interface{}) (bool, error) {
+	if err := r.ctxErr(); err != nil {
+		return false, err
+	}
+	fn := translatePath(r.instanceType, strings.Replace(field, ".", "__", -1))
+	if _, ok := resolveField(r.instanceType, fn); !ok {
+		return false, &FilterError{Field: field}
+	}
+	qs := r.query(r.Orm)
+	if value == nil {
+		qs = qs.Filter(fn+"__isnull", true)
+	} else {
+		qs = qs.Filter(fn, value)
+	}
+	if r.softDelete != "" {
+		qs = qs.Filter(r.softDelete+"__isnull", true)
+	}
+	// Count instead of Exist, that runs the same query but hides its errors
+	count, err := r.self.PrepareQuery(qs).Count()
+	return count > 0, err
 }
 
 func (r *BaseRepository) Count(options ...QueryOptions) (int64, error) {
-	qs := r.Orm.QueryTable(r.table)
+	if err := r.ctxErr(); err != nil {
+		return 0, err
+	}
+	if len(options) > 0 && options[0].After != "" {
+		opt := options[0]
+		opt.After = ""
+		options = []QueryOptions{opt}
+	}
+	qs := r.query(r.Orm)
 	qs = r.AddFilters(qs, options)
-	return qs.Count()
+	return r.self.PrepareQuery(qs).Count()
 }
 
 func (r *BaseRepository) ReadAll(dataSet interface{}, options ...QueryOptions) error {
-	qs := r.Orm.QueryTable(r.table)
+	if err := r.ctxErr(); err != nil {
+		return err
+	}
+	if len(options) > 0 && len(options[0].Fields) > 0 {
+		previous, columns := r.related, r.columns
+		r.related = fieldRelations(r.instanceType, options[0].Fields)
+		fields := options[0].Fields
+		if f, _, ok := r.keysetField(options[0]); ok {
+			// The sort field is needed to compute the cursor of the entities
+			fields = append(fields[:len(fields):len(fields)], f.Name)
+		}
+		r.columns = r.selectedColumns(fields)
+		defer func() { r.related, r.columns = previous, columns }()
+	}
+	qs := r.query(r.Orm)
 	qs = r.AddOptions(qs, options)
 	qs = r.AddFilters(qs, options)
-	_, err := r.self.All(qs, dataSet)
-	return err
-}
-
-func (r *BaseRepository) Save(p interface{}) (int64, error) {
-	return r.Orm.Insert(p)
+	// Some drivers, and All overrides, report an empty result as ErrNoRows, that is not an error for lists
+	if _, err := r.self.All(r.self.PrepareQuery(qs), dataSet); err != nil && err != orm.ErrNoRows {
+		return err
+	}
+	prefetch := r.prefetch
+	if len(options) > 0 && len(options[0].Fields) > 0 {
+		prefetch = referencedRelations(r.prefetch, options[0].Fields)
+	}
+	return r.loadPrefetched(dataSet, prefetch)
 }
 
-func (r *BaseRepository) Update(p interface{}, cols ...string) error {
-	count, err := r.Orm.Update(p, cols...)
-	if err != nil {
-		return err
+/*
+WithRelations restricts the relations loaded into the entities returned by Read and ReadAll, with
+RelatedSel, to the given fk and one-to-one relations, ex: WithRelations("Author", "Author__Publisher").
+By default all of them are loaded, which can be slow for entities with many or deep relations. The
+relations not loaded only have their id set. When the options have Fields, the relations referenced by
+them are loaded instead
+*/
+func (r *BaseRepository) WithRelations(relations ...string) {
+	if len(relations) == 0 {
+		panic(fmt.Sprintf("ngago: no relations given for %s, use WithoutRelations to load none", r.table))
 	}
-	if count == 0 {
-		return ErrNotFound
+	for _, rel := range relations {
+		t := r.instanceType
+		for _, name := range strings.Split(rel, "__") {
+			f, ok := findField(t, name)
+			if !ok || !isRelation(f) {
+				panic(fmt.Sprintf("ngago: invalid relation %s for %s", rel, r.table))
+			}
+			t = indirectType(f.Type)
+		}
 	}
-	return err
+	r.related = relations
 }
 
-func (r *BaseRepository) Delete(id int64) error {
-	_, err := r.Orm.QueryTable(r.table).Filter("Id", id).Delete()
-	return err
+// WithoutRelations disables the loading of relations into the entities returned by Read and ReadAll, that
+// only have their ids set. Relations referenced by the Fields of the options are still loaded
+func (r *BaseRepository) WithoutRelations() {
+	r.related = []string{}
 }
 
-func (r *BaseRepository) AddOptions(qs orm.QuerySeter, options []QueryOptions) orm.QuerySeter {
-	if len(options) == 0 {
-		return qs
+/*
+Prefetch declares many-to-many or reverse many relations, ex: "Roles", to be loaded into the entities
+returned by Read and ReadAll, as RelatedSel only loads the fk and one-to-one relations. The relations
+are loaded with the orm LoadRelated, with a query per entity and relation. When the options have
+Fields, only the relations referenced by them are loaded
+*/
+func (r *BaseRepository) Prefetch(relations ...string) {
+	r.prefetch = append(r.prefetch, relations...)
+}
+
+// loadPrefetched loads the relations into data, an entity or a pointer to a slice of entities
+func (r *BaseRepository) loadPrefetched(data interface{}, relations []string) error {
+	if len(relations) == 0 {
+		return nil
 	}
-	opt := options[0]
-	sort := strings.Split(opt.Sort, ",")
-	reverse := strings.ToLower(opt.Order) == "desc"
-	for i, s := range sort {
-		s = strings.TrimSpace(s)
-		if reverse {
-			if s[0] == '-' {
-				s = strings.TrimPrefix(s, "-")
-			} else {
-				s = "-" + s
+	entities := []interface{}{data}
+	if items := reflect.Indirect(reflect.ValueOf(data)); items.Kind() == reflect.Slice {
+		entities = make([]interface{}, items.Len())
+		for i := range entities {
+			item := items.Index(i)
+			if item.Kind() != reflect.Ptr {
+				item = item.Addr()
 			}
+			entities[i] = item.Interface()
 		}
-		sort[i] = strings.Replace(s, ".", "__", -1)
 	}
-	if opt.Sort != "" {
-		qs = qs.OrderBy(sort...)
-	}
-	if opt.Max > 0 {
-		qs = qs.Limit(opt.Max)
+	for _, entity := range entities {
+		for _, rel := range relations {
+			if _, err := r.Orm.LoadRelated(entity, rel); err != nil && err != orm.ErrNoRows {
+				return err
+			}
+		}
 	}
-	if opt.Offset > 0 {
-		qs = qs.Offset(opt.Offset)
+	return nil
+}
+
+/*
+selectedColumns returns the fields to read for the requested fields, given by field name or JSON key:
+the first element of each dotted field, ex: "author" for "author.name", always preceded by the primary
+key. Unknown fields are ignored with a warning, and many relations, that are not columns, are skipped
+*/
+func (r *BaseRepository) selectedColumns(fields []string) []string {
+	columns := []string{r.idField.Name}
+	seen := map[string]bool{r.idField.Name: true}
+	for _, path := range fields {
+		name := strings.TrimSpace(strings.Split(path, ".")[0])
+		f, ok := findField(r.instanceType, name)
+		if matches := jsonFields(r.instanceType, []string{name}); len(matches) > 0 {
+			f, ok = matches[0], true
+		}
+		if !ok {
+			r.warn(fmt.Sprintf("Unknown field %s ignored", path))
+			continue
+		}
+		if seen[f.Name] || hasOrmTag(f, "reverse(many)") || hasOrmTag(f, "rel(m2m)") {
+			continue
+		}
+		seen[f.Name] = true
+		columns = append(columns, f.Name)
 	}
-	return qs
+	return columns
 }
 
-func (r *BaseRepository) AddFilters(qs orm.QuerySeter, options []QueryOptions) orm.QuerySeter {
-	if len(options) != 0 {
-		for f, v := range options[0].Filters {
-			fn := strings.Replace(f, ".", "__", -1)
-			var s string
-			if i, ok := v.(float64); ok {
-				s = strconv.FormatFloat(i, 'f', -1, 64)
-			} else {
-				s = v.(string)
+// referencedRelations filters the relations referenced by the first element of any of the dotted fields
+func referencedRelations(relations, fields []string) []string {
+	var referenced []string
+	for _, rel := range relations {
+		for _, f := range fields {
+			if strings.EqualFold(strings.Split(strings.TrimSpace(f), ".")[0], rel) {
+				referenced = append(referenced, rel)
+				break
 			}
+		}
+	}
+	return referenced
+}
 
-			if ff, ok := r.filterMap[f]; ok {
-				qs = ff(qs, fn, s)
-			} else if strings.HasSuffix(fn, "Id") || strings.HasSuffix(fn, "__id") {
-				qs = IdFilter(qs, fn, s)
-			} else {
-				qs = StartsWithFilter(qs, fn, s)
+/*
+ProcessInChunks walks all entities matching the options filters in chunks of chunkSize, calling fn
+for each chunk inside its own transaction, or inside the transaction the repository is bound to, if any.
+The chunk is a pointer to a slice, as returned by NewSlice, and tx must be used for any write done by fn.
+If fn returns an error, that chunk is rolled back and the processing stops.
+
+Chunks are read in primary key order, starting after the last id of the previous chunk, so rows changed by fn
+do not shift the following chunks. Sorting and pagination options are ignored.
+*/
+func (r *BaseRepository) ProcessInChunks(chunkSize int, fn func(tx orm.Ormer, chunk interface{}) error, options ...QueryOptions) error {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	var last interface{}
+	for {
+		if err := r.ctxErr(); err != nil {
+			return err
+		}
+		var size int
+		err := r.withTx(func(tx orm.Ormer) error {
+			qs := r.query(tx)
+			qs = r.AddFilters(qs, options)
+			if last != nil {
+				qs = qs.Filter(r.idField.Name+"__gt", last)
+			}
+			qs = qs.OrderBy(r.idField.Name).Limit(chunkSize)
+			chunk := r.NewSlice()
+			if _, err := r.self.All(r.self.PrepareQuery(qs), chunk); err != nil {
+				return err
+			}
+			items := reflect.ValueOf(chunk).Elem()
+			if size = items.Len(); size == 0 {
+				return nil
 			}
+			last = r.idOf(items.Index(size - 1).Interface())
+			return fn(tx, chunk)
+		})
+		if err != nil || size < chunkSize {
+			return err
 		}
 	}
-	return qs
 }
 
-func IdFilter(qs orm.QuerySeter, field, value string) orm.QuerySeter {
-	field = strings.TrimSuffix(field, "Id") + "__id"
-	id, _ := strconv.Atoi(value)
-	return qs.Filter(field, id)
+/*
+Claim locks up to n entities matching the options filters, in the options sort order, skipping the rows
+already locked by other transactions, and calls fn with them inside the locking transaction. This allows
+workers to claim batches of pending jobs without contending, ex: with a {"Status": "pending"} filter and
+fn updating the status of the claimed jobs with tx. The claimed entities are a pointer to a slice, as
+returned by NewSlice, and fn is not called when there's nothing to claim. If fn returns an error, the
+transaction is rolled back and the entities are released.
+
+It's implemented with SELECT ... FOR UPDATE SKIP LOCKED, and so is only supported by the PostgreSQL,
+MySQL (8.0+) and Oracle backends.
+*/
+func (r *BaseRepository) Claim(n int, fn func(tx orm.Ormer, claimed interface{}) error, options ...QueryOptions) error {
+	if err := r.ctxErr(); err != nil {
+		return err
+	}
+	var quote string
+	switch r.Orm.Driver().Type() {
+	case orm.DRPostgres, orm.DROracle:
+		quote = `"`
+	case orm.DRMySQL:
+		quote = "`"
+	default:
+		return fmt.Errorf("ngago: Claim is not supported by the database backend of the %q alias", r.Orm.Driver().Name())
+	}
+	return r.withTx(func(tx orm.Ormer) error {
+		qs := r.query(tx)
+		qs = r.AddOptions(qs, options)
+		qs = r.AddFilters(qs, options).Limit(n)
+		var candidates orm.ParamsList
+		if _, err := qs.ValuesFlat(&candidates, r.idField.Name); err != nil || len(candidates) == 0 {
+			return err
+		}
+		marks := strings.TrimSuffix(strings.Repeat("?, ", len(candidates)), ", ")
+		query := fmt.Sprintf("SELECT %[1]s%[2]s%[1]s FROM %[1]s%[3]s%[1]s WHERE %[1]s%[2]s%[1]s IN (%[4]s) FOR UPDATE SKIP LOCKED",
+			quote, r.idField.Column, r.table, marks)
+		var ids orm.ParamsList
+		if _, err := tx.Raw(query, candidates...).ValuesFlat(&ids); err != nil || len(ids) == 0 {
+			return err
+		}
+		claimed := r.NewSlice()
+		qs = r.AddOptions(r.query(tx), options).Filter(r.idField.Name+"__in", ids...)
+		if _, err := r.self.All(r.self.PrepareQuery(qs), claimed); err != nil {
+			return err
+		}
+		return fn(tx, claimed)
+	})
 }
 
-func BooleanFilter(qs orm.QuerySeter, field, value string) orm.QuerySeter {
-	return qs.Filter(field, value == "true")
+/*
+Summary computes aggregates over all entities matching the options filters. The fields map a result
+key to an aggregate expression, one of count, sum, avg, min or max applied to a field name, ex:
+{"totalAmount": "sum(Amount)", "orders": "count(*)", "lastOrder": "max(CreatedAt)"}.
+
+The aggregates are computed by the application while reading the requested columns of the filtered
+rows, as the orm does not support aggregate expressions.
+*/
+func (r *BaseRepository) Summary(fields map[string]string, options ...QueryOptions) (map[string]interface{}, error) {
+	if err := r.ctxErr(); err != nil {
+		return nil, err
+	}
+	aggs, columns, err := parseAggregates(fields)
+	if err != nil {
+		return nil, err
+	}
+	qs := r.query(r.Orm)
+	qs = r.self.PrepareQuery(r.AddFilters(qs, options))
+	accs := make(map[string]*accumulator, len(aggs))
+	for key, agg := range aggs {
+		accs[key] = newAccumulator(agg)
+	}
+	if len(columns) == 0 {
+		count, err := qs.Count()
+		if err != nil {
+			return nil, err
+		}
+		for _, acc := range accs {
+			acc.count = count
+		}
+	} else {
+		var rows []orm.ParamsList
+		if _, err := qs.ValuesList(&rows, columns...); err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			for _, acc := range accs {
+				acc.add(row)
+			}
+		}
+	}
+	result := make(map[string]interface{}, len(accs))
+	for key, acc := range accs {
+		result[key] = acc.result()
+	}
+	return result, nil
 }
 
-func StartsWithFilter(qs orm.QuerySeter, field, value string) orm.QuerySeter {
-	return qs.Filter(field+"__istartswith", value)
+/*
+Distinct lists the distinct values of a field among the entities matching the options filters, sorted, ex:
+Distinct("Status") -> ["new", "paid", "shipped"]. The field is referenced by name, column or JSON key, and
+fields of relations with a dotted path, ex: "User.Name", but not through many-to-many or reverse many
+relations. At most options.Max values are returned, and never more than MaxDistinctValues. The sort and
+offset of the options are ignored
+*/
+func (r *BaseRepository) Distinct(field string, options ...QueryOptions) ([]interface{}, error) {
+	if err := r.ctxErr(); err != nil {
+		return nil, err
+	}
+	path := translatePath(r.instanceType, strings.Replace(strings.TrimSpace(field), ".", "__", -1))
+	if _, ok := resolveField(r.instanceType, path); !ok || isToMany(r.instanceType, path) {
+		return nil, fmt.Errorf("invalid distinct field %q", field)
+	}
+	max := MaxDistinctValues
+	if len(options) > 0 && options[0].Max > 0 && (max <= 0 || options[0].Max < max) {
+		max = options[0].Max
+	}
+	qs := r.query(r.Orm)
+	qs = r.self.PrepareQuery(r.AddFilters(qs, options)).Distinct().OrderBy(path)
+	if max > 0 {
+		qs = qs.Limit(max)
+	}
+	var values orm.ParamsList
+	if _, err := qs.ValuesFlat(&values, path); err != nil && err != orm.ErrNoRows {
+		return nil, err
+	}
+	if values == nil {
+		values = orm.ParamsList{}
+	}
+	return values, nil
 }
 
-func ContainsWithFilter(qs orm.QuerySeter, field, value string) orm.QuerySeter {
-	return qs.Filter(field+"__icontains", value)
+/*
+Aggregate computes aggregates, as Summary does, for each group of the entities matching the options filters
+with the same values for the groupBy fields, ex: Aggregate([]string{"Status"}, {"total": "sum(Amount)"})
+-> [{"Status": "new", "total": 15}, {"Status": "shipped", "total": 20}]. Each result has the values of the
+groupBy fields, under the given names, and the aggregates. Fields of relations are referenced with a
+dotted path, ex: "User.Name", but not through many-to-many or reverse many relations. The groups are
+sorted by their values, and there are no results, not even empty groups, when no entity matches
+*/
+func (r *BaseRepository) Aggregate(groupBy []string, aggregates map[string]string, options ...QueryOptions) ([]map[string]interface{}, error) {
+	if err := r.ctxErr(); err != nil {
+		return nil, err
+	}
+	if len(groupBy) == 0 {
+		return nil, errors.New("ngago: no fields to group by")
+	}
+	aggs, columns, err := parseAggregates(aggregates)
+	if err != nil {
+		return nil, err
+	}
+	var groupColumns []string
+	for _, f := range groupBy {
+		path := strings.Replace(strings.TrimSpace(f), ".", "__", -1)
+		if _, ok := resolveField(r.instanceType, path); !ok || isToMany(r.instanceType, path) {
+			return nil, fmt.Errorf("invalid group by field %q", f)
+		}
+		groupColumns = append(groupColumns, path)
+	}
+	qs := r.query(r.Orm)
+	qs = r.self.PrepareQuery(r.AddFilters(qs, options)).OrderBy(groupColumns...)
+	var rows []orm.ParamsList
+	if _, err := qs.ValuesList(&rows, append(groupColumns, columns...)...); err != nil {
+		return nil, err
+	}
+	n := len(groupColumns)
+	var keys []string
+	groups := make(map[string]*aggregateGroup)
+	for _, row := range rows {
+		key := fmt.Sprintf("%#v", []interface{}(row[:n]))
+		g, ok := groups[key]
+		if !ok {
+			g = newAggregateGroup(row[:n], aggs)
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		for _, acc := range g.accs {
+			acc.add(row[n:])
+		}
+	}
+	results := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		results = append(results, groups[key].result(groupBy))
+	}
+	return results, nil
+}
+
+/*
+SyncChildren makes the collection of entities matching scopeFilter exactly equal to desired, a slice of
+entities (or pointers to entities), in a single transaction: entities without Id are inserted, entities
+with the Id of an existing row in the scope are updated, and rows in the scope missing from desired are
+deleted. The scope keys are orm field expressions matched exactly, ex: {"Invoice": 5}, and desired
+entities are expected to belong to the scope already. If a desired entity has an Id that's not part of
+the scope, nothing is changed and ErrNotFound is returned.
+*/
+func (r *BaseRepository) SyncChildren(scopeFilter map[string]interface{}, desired interface{}) error {
+	if err := r.ctxErr(); err != nil {
+		return err
+	}
+	items := reflect.Indirect(reflect.ValueOf(desired))
+	if items.Kind() != reflect.Slice {
+		return fmt.Errorf("ngago: SyncChildren expects a slice of entities, got %T", desired)
+	}
+	return r.withTx(func(tx orm.Ormer) error {
+		qs := r.query(tx)
+		for f, v := range scopeFilter {
+			qs = qs.Filter(strings.Replace(f, ".", "__", -1), v)
+		}
+		var ids orm.ParamsList
+		if _, err := qs.ValuesFlat(&ids, r.idField.Name); err != nil {
+			return err
+		}
+		existing := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			existing[fmt.Sprint(id)] = false
+		}
+		for i := 0; i < items.Len(); i++ {
+			item := items.Index(i)
+			if item.Kind() != reflect.Ptr {
+				item = item.Addr()
+			}
+			entity := item.Interface()
+			r.setTenants(entity)
+			id := r.idOf(entity)
+			if _, ok := existing[fmt.Sprint(id)]; !isZeroId(id) && !ok {
+				return ErrNotFound
+			}
+			var err error
+			if isZeroId(id) {
+				_, err = insert(tx, entity)
+			} else {
+				_, err = update(tx, entity)
+				existing[fmt.Sprint(id)] = true
+			}
+			if err != nil {
+				return err
+			}
+		}
+		var missing []interface{}
+		for _, id := range ids {
+			if !existing[fmt.Sprint(id)] {
+				missing = append(missing, id)
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		_, err := r.query(tx).Filter(r.idField.Name+"__in", missing...).Delete()
+		return err
+	})
+}
+
+// Paginate reads a page of entities, as specified by the options, along with the total count of
+// entities matching the options filters. Items is a pointer to a slice, as returned by NewSlice
+func (r *BaseRepository) Paginate(options QueryOptions) (PageResult, error) {
+	items := r.NewSlice()
+	if err := r.ReadAll(items, options); err != nil {
+		return PageResult{}, err
+	}
+	total, err := r.Count(options)
+	if err != nil {
+		return PageResult{}, err
+	}
+	page := 1
+	if options.Max > 0 {
+		page = options.Offset/options.Max + 1
+	}
+	return PageResult{Items: items, Total: total, Page: page, PerPage: options.Max, TotalPages: totalPages(total, options.Max)}, nil
+}
+
+func (r *BaseRepository) Save(p interface{}) (int64, error) {
+	if err := r.ctxErr(); err != nil {
+		return 0, err
+	}
+	r.setTenants(p)
+	return insert(r.Orm, p)
+}
+
+/*
+Upsert inserts the entity when its id is not set, ex: 0, as Save does, and else updates it, or inserts it
+with that id when there's no entity with it. It returns the id of the entity, as Save does, in both cases.
+
+With MySQL and PostgreSQL (9.5 or later), entities with an id are upserted atomically with the orm
+InsertOrUpdate, in a single statement (ON DUPLICATE KEY UPDATE and ON CONFLICT on the primary key). As
+it can't tell if the entity was inserted or updated, no hooks are run. With the other backends, like
+SQLite, the update is tried first, and the insert when no entity was updated, in a transaction, running
+the hooks of the one that succeeds.
+
+Only the primary key selects the entity to update: a conflict on any other unique column, ex: a new id with
+a taken email, fails with the database error (see IsUniqueViolation), and never updates the other entity.
+With MySQL, that is not the case, as ON DUPLICATE KEY UPDATE matches any unique key. Repositories scoped with
+ScopeTenant always check the entity in a transaction, as the other backends do, to never update other tenants
+*/
+func (r *BaseRepository) Upsert(p interface{}) (int64, error) {
+	if err := r.ctxErr(); err != nil {
+		return 0, err
+	}
+	id := r.idOf(p)
+	if isZeroId(id) {
+		return r.Save(p)
+	}
+	r.setTenants(p)
+	var err error
+	switch driver := r.Orm.Driver().Type(); {
+	case len(r.tenants) > 0:
+		// The entity may be of another tenant, that must not be updated
+		err = r.withTx(func(tx orm.Ormer) error {
+			exists, err := r.inScope(tx, p)
+			if err == nil && exists {
+				_, err = update(tx, p)
+			} else if err == nil {
+				_, err = insert(tx, p)
+			}
+			return err
+		})
+	case driver == orm.DRMySQL:
+		_, err = r.Orm.InsertOrUpdate(p)
+	case driver == orm.DRPostgres:
+		_, err = r.Orm.InsertOrUpdate(p, r.idField.Column)
+	default:
+		err = r.withTx(func(tx orm.Ormer) error {
+			count, err := update(tx, p)
+			if err != nil || count > 0 {
+				return err
+			}
+			_, err = insert(tx, p)
+			return err
+		})
+	}
+	if err != nil {
+		return 0, err
+	}
+	switch v := reflect.ValueOf(id); v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), nil
+	}
+	return 0, nil
+}
+
+func (r *BaseRepository) Update(p interface{}, cols ...string) error {
+	if err := r.ctxErr(); err != nil {
+		return err
+	}
+	if len(r.tenants) > 0 {
+		r.setTenants(p)
+		if exists, err := r.inScope(r.Orm, p); err != nil || !exists {
+			if err == nil {
+				err = ErrNotFound
+			}
+			return err
+		}
+	}
+	if r.lockField.Name != "" {
+		return r.lockedUpdate(p, cols...)
+	}
+	count, err := update(r.Orm, p, cols...)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+/*
+UpdateMany sets the same changes, a map of field names to values, to all the entities with the given ids
+in a single query, ex: UpdateMany(ids, map[string]interface{}{"Status": "shipped"}), returning the number
+of entities updated. The entities are not read, so their BeforeUpdater and AfterUpdater hooks are not run
+*/
+func (r *BaseRepository) UpdateMany(ids []interface{}, changes map[string]interface{}) (int64, error) {
+	if len(ids) == 0 || len(changes) == 0 {
+		return 0, nil
+	}
+	if err := r.ctxErr(); err != nil {
+		return 0, err
+	}
+	params := make(orm.Params, len(changes))
+	for k, v := range changes {
+		params[k] = v
+		// Entities can't be moved to other tenants
+		for _, t := range r.tenants {
+			if f, ok := findField(r.instanceType, k); ok && f.Name == t.field.Name {
+				params[k] = t.value.Interface()
+			}
+		}
+	}
+	return r.query(r.Orm).Filter(r.idField.Name+"__in", ids...).Update(params)
+}
+
+// Increment atomically adds delta to the numeric field of the entity with the given id, returning
+// ErrNotFound if there's no such entity
+func (r *BaseRepository) Increment(id interface{}, field string, delta int64) error {
+	if err := r.ctxErr(); err != nil {
+		return err
+	}
+	qs := r.query(r.Orm).Filter(r.idField.Name, id)
+	var count int64
+	var err error
+	if delta == 0 {
+		// Exist hides the errors of the query
+		count, err = qs.Count()
+	} else {
+		count, err = qs.Update(orm.Params{field: orm.ColValue(orm.ColAdd, delta)})
+	}
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete deletes the entity with the given id, returning ErrNotFound if there's no such entity. When
+// configured with SoftDelete, it's marked as deleted instead, and entities already deleted are not found
+// either
+func (r *BaseRepository) Delete(id interface{}) error {
+	if err := r.ctxErr(); err != nil {
+		return err
+	}
+	return r.deleteOne(r.query(r.Orm).Filter(r.idField.Name, id))
+}
+
+// deleteOne deletes the single entity matched by qs, as Delete does
+func (r *BaseRepository) deleteOne(qs orm.QuerySeter) error {
+	var count int64
+	var err error
+	if r.softDelete == "" {
+		count, err = qs.Delete()
+	} else {
+		count, err = r.markDeleted(qs)
+	}
+	if err == nil && count == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+// markDeleted sets the SoftDelete field of the active entities of qs to the current time
+func (r *BaseRepository) markDeleted(qs orm.QuerySeter) (int64, error) {
+	return qs.Filter(r.softDelete+"__isnull", true).Update(orm.Params{r.softDelete: time.Now()})
+}
+
+// DeleteMany deletes all the entities with the given ids in a single query, returning the number of entities
+// deleted. An empty list of ids is rejected with ErrNoIds, so it never deletes the whole table
+func (r *BaseRepository) DeleteMany(ids []interface{}) (int64, error) {
+	if len(ids) == 0 {
+		return 0, ErrNoIds
+	}
+	if err := r.ctxErr(); err != nil {
+		return 0, err
+	}
+	qs := r.query(r.Orm).Filter(r.idField.Name+"__in", ids...)
+	if r.softDelete != "" {
+		return r.markDeleted(qs)
+	}
+	return qs.Delete()
+}
+
+/*
+ReadMany reads the entities with the given ids into dataSet in a single query, in the same order as the
+ids. Ids without an entity, or of soft-deleted entities, are left out, and an empty list of ids reads no
+entity
+*/
+func (r *BaseRepository) ReadMany(ids []interface{}, dataSet interface{}) error {
+	if err := r.ctxErr(); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	qs := r.query(r.Orm).Filter(r.idField.Name+"__in", ids...)
+	if r.softDelete != "" {
+		qs = qs.Filter(r.softDelete+"__isnull", true)
+	}
+	if _, err := r.self.All(r.self.PrepareQuery(qs), dataSet); err != nil && err != orm.ErrNoRows {
+		return err
+	}
+	order := make(map[string]int, len(ids))
+	for i, id := range ids {
+		if _, ok := order[fmt.Sprint(id)]; !ok {
+			order[fmt.Sprint(id)] = i
+		}
+	}
+	items := reflect.Indirect(reflect.ValueOf(dataSet))
+	sorted := reflect.MakeSlice(items.Type(), items.Len(), items.Len())
+	reflect.Copy(sorted, items)
+	sort.SliceStable(sorted.Interface(), func(i, j int) bool {
+		return order[fmt.Sprint(r.idOf(sorted.Index(i).Interface()))] < order[fmt.Sprint(r.idOf(sorted.Index(j).Interface()))]
+	})
+	items.Set(sorted)
+	return r.loadPrefetched(dataSet, r.prefetch)
+}
+
+// Warnings returns the warnings about ignored filters and sort fields of all queries done by the repository
+func (r *BaseRepository) Warnings() []string {
+	return r.warnings
+}
+
+func (r *BaseRepository) warn(msg string) {
+	r.log().Warn(msg)
+	r.warnings = append(r.warnings, msg)
+}
+
+func (r *BaseRepository) idOf(entity interface{}) interface{} {
+	return reflect.Indirect(reflect.ValueOf(entity)).FieldByIndex(r.idField.Index).Interface()
+}
+
+func (r *BaseRepository) AddOptions(qs orm.QuerySeter, options []QueryOptions) orm.QuerySeter {
+	if len(options) == 0 {
+		return qs
+	}
+	opt := options[0]
+	if opt.Sort != "" {
+		var sort []string
+		reverse := strings.ToLower(opt.Order) == "desc"
+		for _, s := range strings.Split(opt.Sort, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			nulls := opt.Nulls
+			if m := nullsDirective.FindStringSubmatch(s); m != nil {
+				s, nulls = s[:len(s)-len(m[0])], m[1]
+			}
+			if reverse {
+				if s[0] == '-' {
+					s = strings.TrimPrefix(s, "-")
+				} else {
+					s = "-" + s
+				}
+			}
+			s = strings.Replace(s, ".", "__", -1)
+			if _, ok := resolveField(r.instanceType, strings.TrimPrefix(s, "-")); !ok {
+				r.warn(fmt.Sprintf("Unknown sort field %s ignored", strings.TrimPrefix(s, "-")))
+				continue
+			}
+			if !r.isSortAllowed(strings.TrimPrefix(s, "-")) {
+				r.warn(fmt.Sprintf("Sort field %s is not allowed", strings.TrimPrefix(s, "-")))
+				continue
+			}
+			if strings.HasPrefix(s, "-") {
+				s = "-" + translatePath(r.instanceType, s[1:])
+			} else {
+				s = translatePath(r.instanceType, s)
+			}
+			r.checkNullsOrder(s, nulls)
+			sort = append(sort, s)
+		}
+		if len(sort) > 0 {
+			qs = qs.OrderBy(sort...)
+		}
+	}
+	// The ordering of the scopes is kept for pages of lists with no sort, as long as they have no cursor
+	if opt.After != "" || opt.Sort != "" || (opt.Max > 0 && !isOrdered(qs)) {
+		// Pages are sorted by id as well, so ties on the sort field have a stable order across pages and
+		// the cursors of their entities can be compared
+		if f, desc, ok := r.keysetField(opt); ok {
+			if f.Name != r.idField.Name {
+				qs = qs.OrderBy(sortExpr(f.Name, desc), sortExpr(r.idField.Name, desc))
+			} else {
+				qs = qs.OrderBy(sortExpr(r.idField.Name, desc))
+			}
+		}
+	}
+	if opt.Max > 0 {
+		qs = qs.Limit(opt.Max)
+	}
+	if opt.Offset > 0 && opt.After == "" {
+		qs = qs.Offset(opt.Offset)
+	}
+	return qs
+}
+
+func sortExpr(field string, desc bool) string {
+	if desc {
+		return "-" + field
+	}
+	return field
+}
+
+/*
+checkNullsOrder verifies a nulls ordering directive for a sort field against the database backend.
+The orm can't emit NULLS FIRST/LAST clauses, so a directive is only honored when it matches the
+backend's natural ordering for the sort direction: MySQL, TiDB and SQLite sort nulls as the smallest
+values, PostgreSQL and Oracle as the largest ones. Directives that can't be honored are logged
+*/
+func (r *BaseRepository) checkNullsOrder(field, nulls string) {
+	nulls = strings.ToLower(nulls)
+	if nulls == "" {
+		return
+	}
+	desc := strings.HasPrefix(field, "-")
+	var nullsLargest bool
+	switch r.Orm.Driver().Type() {
+	case orm.DRPostgres, orm.DROracle:
+		nullsLargest = true
+	}
+	if (nulls == "first") == (nullsLargest == desc) {
+		return
+	}
+	r.warn(fmt.Sprintf("Nulls %s ordering for %s is not supported by the database backend", nulls, strings.TrimPrefix(field, "-")))
+}
+
+/*
+ValidateOptions checks that all filters in the options are either registered with AddFilter or
+reference a known field of the entity, possibly through a relation (ex: "author.name" or "authorId"),
+and are not denied by DenyFilters or left out by AllowFilters, returning a *FilterError otherwise. When
+AllowSort is configured, it also checks the sort fields, returning a *SortError for the others. An After
+cursor that can't be used is rejected with ErrInvalidCursor.
+*/
+func (r *BaseRepository) ValidateOptions(options QueryOptions) error {
+	if options.After != "" {
+		if _, err := r.afterCondition(options); err != nil {
+			return err
+		}
+	}
+	for _, s := range strings.Split(options.Sort, ",") {
+		s = strings.TrimPrefix(strings.TrimSpace(nullsDirective.ReplaceAllString(s, "")), "-")
+		if s != "" && !r.isSortAllowed(s) {
+			return &SortError{Field: s}
+		}
+	}
+	for f, v := range options.Filters {
+		if f == OrFilter {
+			branches, ok := orBranches(v)
+			if !ok {
+				return &FilterError{Field: f}
+			}
+			for _, branch := range branches {
+				if err := r.ValidateOptions(QueryOptions{Filters: branch}); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if r.isDenied(f) || !r.isFilterAllowed(f) {
+			return &FilterError{Field: f}
+		}
+		if _, ok := r.filterMap[f]; ok {
+			continue
+		}
+		if _, _, _, ok := r.operatorFilter(f); ok {
+			continue
+		}
+		if _, _, ok := r.parseAnnotation(f); ok {
+			continue
+		}
+		field, op := r.parseOperator(f)
+		if isIntervalOperator(op) {
+			if _, err := intervalBounds(r.filterType(field), op, v); err != nil {
+				return fmt.Errorf("invalid value for filter %s: %v", f, err)
+			}
+		}
+		fn := strings.Replace(field, ".", "__", -1)
+		if _, ok := resolveField(r.instanceType, fn); ok {
+			continue
+		}
+		if strings.HasSuffix(fn, "Id") {
+			if _, ok := resolveField(r.instanceType, strings.TrimSuffix(fn, "Id")); ok {
+				continue
+			}
+		}
+		return &FilterError{Field: f}
+	}
+	return nil
+}
+
+/*
+AddFilters applies the condition built by BuildFilterCondition for the options to qs, along with the
+condition of the After cursor, if any. They are ANDed with the conditions previously added to qs, when
+it's started with NewQuery, as the queries passed to PrepareQuery, All and One are. The conditions of other
+queries, ex: of Orm.QueryTable, are replaced
+*/
+func (r *BaseRepository) AddFilters(qs orm.QuerySeter, options []QueryOptions) orm.QuerySeter {
+	if len(options) == 0 {
+		options = []QueryOptions{{}}
+	}
+	cond := r.self.BuildFilterCondition(options[0])
+	if options[0].After != "" {
+		if after, err := r.afterCondition(options[0]); err != nil {
+			r.warn("Invalid cursor ignored")
+		} else if cond == nil {
+			cond = after
+		} else {
+			cond = cond.AndCond(after)
+		}
+	}
+	if cond == nil || cond.IsEmpty() {
+		return qs
+	}
+	previous, ok := queryCond(qs)
+	if !ok {
+		r.log().Warn("Conditions of a", r.table, "query not started with NewQuery are replaced by its filters")
+	}
+	return qs.SetCond(andConds(previous, cond))
+}
+
+/*
+BuildFilterCondition assembles the condition for all the filters in the options: custom filters
+registered with AddFilter, then AddOperatorFilter, annotations, operator suffixes, typed and plain
+fields, in this order of precedence. Subclasses can override it to customize or audit how the filters are
+combined.
+
+Filters through many-to-many or reverse many relations, ex: "roles.name", are resolved to the matching
+ids with a separate query, applied as an Id__in filter, so the entities are not duplicated by the join.
+
+Plain fields filtered by null or a boolean are matched exactly, ex: {"deletedAt": null}. Values that
+can't be used as filters, like JSON objects, are ignored with a warning.
+
+The OrFilter key holds a list of filter maps, the branches, matching the entities that match any of them,
+ex: {"_or": [{"status": "active"}, {"status": "pending", "priority_gte": 3}], "ownerId": 5}. Each branch
+is built as the filters of the options, and the other keys are ANDed with the whole group.
+
+FilterFuncs are called with a QuerySeter that records their Filter, Exclude and SetCond calls into the
+condition, any other method is run on a new query of the table and doesn't affect the result
+*/
+func (r *BaseRepository) BuildFilterCondition(options QueryOptions) *orm.Condition {
+	rec := &conditionRecorder{QuerySeter: r.Orm.QueryTable(r.table), cond: orm.NewCondition()}
+	toMany := &conditionRecorder{QuerySeter: rec.QuerySeter, cond: orm.NewCondition()}
+	if r.softDelete != "" && options.Deleted != ScopeAll {
+		rec.Filter(r.softDelete+"__isnull", options.Deleted == ScopeActive)
+	}
+	if options.Search != "" && len(r.searchFields) > 0 {
+		search := orm.NewCondition()
+		for _, f := range r.searchFields {
+			search = search.Or(f+"__icontains", options.Search)
+		}
+		rec.cond = rec.cond.AndCond(search)
+	}
+	for f, v := range options.Filters {
+		if f == OrFilter {
+			r.addOrFilter(rec, v)
+			continue
+		}
+		if r.isDenied(f) || !r.isFilterAllowed(f) {
+			r.warn(fmt.Sprintf("Filter %s is not allowed", f))
+			continue
+		}
+		if ff, field, op, ok := r.operatorFilter(f); ok {
+			s, ok := filterString(v)
+			if values, isList := v.([]interface{}); isList {
+				s, ok = joinFieldValues(values), true
+			}
+			if !ok {
+				r.warn(fmt.Sprintf("Invalid value for filter %s - %#v", f, v))
+				continue
+			}
+			ff(rec, translatePath(r.instanceType, strings.Replace(field, ".", "__", -1)), op, s)
+			continue
+		}
+		fn := translatePath(r.instanceType, strings.Replace(f, ".", "__", -1))
+		var qs orm.QuerySeter = rec
+		if _, ok := r.filterMap[f]; !ok && isToMany(r.instanceType, fn) {
+			qs = toMany
+			fn = ormPath(r.instanceType, fn)
+		}
+		if _, ok := r.filterMap[f]; !ok {
+			if name, op, ok := r.parseAnnotation(f); ok {
+				r.addAnnotationFilter(qs, name, op, v)
+				continue
+			}
+			if field, op := r.parseOperator(f); op != "" {
+				r.addOperatorFilter(qs, field, op, v)
+				continue
+			}
+		}
+		if values, ok := v.([]interface{}); ok {
+			if _, ok := r.filterMap[f]; ok {
+				r.addFilter(qs, f, fn, joinFieldValues(values))
+			} else {
+				r.addInFilter(qs, f, fn, values)
+			}
+			continue
+		}
+		if t, ok := r.fieldTypes[f]; ok {
+			r.addTypedFilter(qs, f, fn, t, v)
+			continue
+		}
+		if _, ok := r.filterMap[f]; !ok && (v == nil || isBool(v)) {
+			if _, ok := resolveField(r.instanceType, fn); ok {
+				if v == nil {
+					qs.Filter(fn+"__isnull", true)
+				} else {
+					qs.Filter(fn, v)
+				}
+				continue
+			}
+		}
+		s, ok := filterString(v)
+		if !ok {
+			r.warn(fmt.Sprintf("Invalid value for filter %s - %#v", f, v))
+			continue
+		}
+		r.addFilter(qs, f, fn, s)
+	}
+	if !toMany.cond.IsEmpty() {
+		var ids orm.ParamsList
+		if _, err := r.query(r.Orm).SetCond(toMany.cond).Distinct().ValuesFlat(&ids, r.idField.Name); err != nil {
+			r.log().Error("Error resolving filters across relations -", err.Error())
+			r.warn("Filters across many relations ignored")
+		} else if len(ids) > 0 {
+			rec.Filter(r.idField.Name+"__in", ids...)
+		} else {
+			rec.Filter(r.idField.Name+"__isnull", true)
+		}
+	}
+	return rec.cond
+}
+
+// addOrFilter adds the condition matching any of the branches of an OrFilter
+func (r *BaseRepository) addOrFilter(rec *conditionRecorder, value interface{}) {
+	branches, ok := orBranches(value)
+	if !ok {
+		r.warn(fmt.Sprintf("Invalid value for filter %s, a list of filters is expected - %#v", OrFilter, value))
+		return
+	}
+	or := orm.NewCondition()
+	for _, branch := range branches {
+		if cond := r.self.BuildFilterCondition(QueryOptions{Filters: branch, Deleted: ScopeAll}); cond != nil && !cond.IsEmpty() {
+			or = or.OrCond(cond)
+		}
+	}
+	if !or.IsEmpty() {
+		rec.cond = rec.cond.AndCond(or)
+	}
+}
+
+// orBranches returns the filter maps of an OrFilter value
+func orBranches(value interface{}) ([]map[string]interface{}, bool) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	branches := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		if branches[i], ok = item.(map[string]interface{}); !ok {
+			return nil, false
+		}
+	}
+	return branches, true
+}
+
+// conditionRecorder is a QuerySeter that accumulates the filters applied to it in a Condition
+type conditionRecorder struct {
+	orm.QuerySeter
+	cond *orm.Condition
+}
+
+func (q *conditionRecorder) Filter(expr string, args ...interface{}) orm.QuerySeter {
+	q.cond = q.cond.And(expr, args...)
+	return q
+}
+
+func (q *conditionRecorder) Exclude(expr string, args ...interface{}) orm.QuerySeter {
+	q.cond = q.cond.AndNot(expr, args...)
+	return q
+}
+
+func (q *conditionRecorder) SetCond(cond *orm.Condition) orm.QuerySeter {
+	q.cond = cond
+	return q
+}
+
+// queryCond returns the condition of the filters added to qs, as SetCond replaces it, if qs keeps it
+func queryCond(qs orm.QuerySeter) (*orm.Condition, bool) {
+	switch q := qs.(type) {
+	case *scopedQuery:
+		return q.cond, true
+	case *conditionRecorder:
+		return q.cond, true
+	}
+	return nil, false
+}
+
+// parseOperator splits a filter key into a field and the operator of the OperatorConvention, of the
+// RangeSuffixes or of the NullSuffix, returning an empty operator when the key has none
+func (r *BaseRepository) parseOperator(key string) (string, string) {
+	if r.operators != nil {
+		if field, op, ok := r.operators(key); ok && r.allowedOps[strings.ToLower(op)] {
+			return field, strings.ToLower(op)
+		}
+	}
+	if field, op, ok := defaultOperator(key); ok && !r.isFilterField(key) && r.isFilterField(field) {
+		return field, op
+	}
+	return key, ""
+}
+
+// isFilterField tells if name references a field of the entity, a relation id, ex: "authorId", or an
+// annotation
+func (r *BaseRepository) isFilterField(name string) bool {
+	if _, ok := r.annotations[name]; ok {
+		return true
+	}
+	fn := strings.Replace(name, ".", "__", -1)
+	if _, ok := resolveField(r.instanceType, fn); ok {
+		return true
+	}
+	if len(fn) > 2 && strings.HasSuffix(fn, "Id") {
+		_, ok := resolveField(r.instanceType, strings.TrimSuffix(fn, "Id"))
+		return ok
+	}
+	return false
+}
+
+// parseAnnotation splits a filter key referencing an annotation into its name and operator
+func (r *BaseRepository) parseAnnotation(key string) (string, string, bool) {
+	if _, ok := r.annotations[key]; ok {
+		return key, "", true
+	}
+	if field, op := r.parseOperator(key); op != "" {
+		if _, ok := r.annotations[field]; ok {
+			return field, op, true
+		}
+	}
+	if i := strings.LastIndex(key, "__"); i > 0 {
+		if _, ok := r.annotations[key[:i]]; ok {
+			return key[:i], strings.ToLower(key[i+2:]), true
+		}
+	}
+	return "", "", false
+}
+
+func (r *BaseRepository) addAnnotationFilter(qs orm.QuerySeter, name, op string, v interface{}) orm.QuerySeter {
+	agg := r.annotations[name]
+	var rows []orm.ParamsList
+	if _, err := r.query(r.Orm).ValuesList(&rows, r.idField.Name, agg.field); err != nil {
+		r.log().Error("Error computing annotation", name, "-", err.Error())
+		r.warn(fmt.Sprintf("Filter %s ignored", name))
+		return qs
+	}
+	var ids []interface{}
+	accs := make(map[interface{}]*accumulator)
+	for _, row := range rows {
+		acc, ok := accs[row[0]]
+		if !ok {
+			acc = newAccumulator(agg)
+			accs[row[0]] = acc
+			ids = append(ids, row[0])
+		}
+		acc.add(row)
+	}
+	// Entities without related rows are not returned by the join, they all get the empty aggregate
+	emptyMatch, err := matchAggregate(newAccumulator(agg).result(), op, v)
+	if err != nil {
+		r.warn(fmt.Sprintf("Invalid value for filter %s - %v", name, err))
+		return qs
+	}
+	var matching, other []interface{}
+	for _, id := range ids {
+		if ok, _ := matchAggregate(accs[id].result(), op, v); ok {
+			matching = append(matching, id)
+		} else {
+			other = append(other, id)
+		}
+	}
+	switch {
+	case emptyMatch && len(other) > 0:
+		return qs.Exclude(r.idField.Name+"__in", other...)
+	case emptyMatch:
+		return qs
+	case len(matching) > 0:
+		return qs.Filter(r.idField.Name+"__in", matching...)
+	}
+	return qs.Filter(r.idField.Name+"__isnull", true)
+}
+
+func (r *BaseRepository) addOperatorFilter(qs orm.QuerySeter, field, op string, v interface{}) orm.QuerySeter {
+	fn := ormPath(r.instanceType, translatePath(r.instanceType, strings.Replace(field, ".", "__", -1)))
+	if path, _, ok := relationId(r.instanceType, fn); ok {
+		fn = path
+	}
+	parse := func(value interface{}) (interface{}, error) {
+		if t, ok := r.fieldTypes[field]; ok {
+			return r.parseFilterValue(field, t, value)
+		}
+		if f, ok := resolveField(r.instanceType, strings.Replace(field, ".", "__", -1)); ok && op != "in" {
+			if t, ok := inferFieldType(f.Type); ok {
+				return t.Parse(value)
+			}
+		}
+		if n, ok := value.(json.Number); ok {
+			return n.String(), nil
+		}
+		return value, nil
+	}
+	if values, ok := v.([]interface{}); ok && !isIntervalOperator(op) {
+		if op != "in" {
+			r.warn(fmt.Sprintf("Invalid value for filter %s__%s - a list is only accepted by in", field, op))
+			return qs
+		}
+		v = joinFieldValues(values)
+	}
+	switch op {
+	case "between", "after", "before":
+		bounds, err := intervalBounds(r.filterType(field), op, v)
+		if err != nil {
+			r.warn(fmt.Sprintf("Invalid value for filter %s_%s - %v", field, op, err))
+			return qs
+		}
+		for _, b := range bounds {
+			qs = qs.Filter(fn+"__"+b.op, b.value)
+		}
+		return qs
+	case "isnull":
+		isNull, err := FieldBool.Parse(v)
+		if err != nil {
+			r.warn(fmt.Sprintf("Invalid value for filter %s__%s - %v", field, op, err))
+			return qs
+		}
+		return qs.Filter(fn+"__isnull", isNull)
+	case "in":
+		var values []interface{}
+		for _, item := range strings.Split(formatFieldValue(v), ",") {
+			value, err := parse(strings.TrimSpace(item))
+			if err != nil {
+				r.warn(fmt.Sprintf("Invalid value for filter %s__%s - %v", field, op, err))
+				return qs
+			}
+			values = append(values, value)
+		}
+		return qs.Filter(fn+"__in", values...)
+	}
+	value, err := parse(v)
+	if err != nil {
+		r.warn(fmt.Sprintf("Invalid value for filter %s__%s - %v", field, op, err))
+		return qs
+	}
+	return qs.Filter(fn+"__"+op, value)
+}
+
+func (r *BaseRepository) addFilter(qs orm.QuerySeter, f, fn, s string) orm.QuerySeter {
+	if ff, ok := r.filterMap[f]; ok {
+		return ff(qs, fn, s)
+	} else if path, pk, ok := relationId(r.instanceType, fn); ok {
+		return idFilter(qs, path, pk, s)
+	} else if r.isIdField(fn) {
+		return idFilter(qs, r.idField.Name, r.idField, s)
+	}
+	if r.defaultFunc != nil {
+		return r.defaultFunc(qs, fn, s)
+	}
+	return StartsWithFilter(qs, fn, s)
+}
+
+/*
+addInFilter matches any of the values, as sent in a JSON array or in repeated params, ex: id=1&id=2. They
+are coerced to the type declared with AddTypedFilter or else to the type of the field, so lists of numbers
+and strings are accepted alike. An empty list matches no entity
+*/
+func (r *BaseRepository) addInFilter(qs orm.QuerySeter, f, fn string, values []interface{}) orm.QuerySeter {
+	if len(values) == 0 {
+		return qs.Filter(r.idField.Name+"__isnull", true)
+	}
+	t, typed := r.fieldTypes[f]
+	if field, ok := resolveField(r.instanceType, fn); ok && !typed {
+		t, typed = inferFieldType(field.Type)
+	} else if path, pk, isId := relationId(r.instanceType, fn); !ok && isId {
+		fn = path
+		t, typed = inferFieldType(pk.Type)
+	}
+	if !typed {
+		t = FieldString
+	}
+	params := make([]interface{}, len(values))
+	for i, v := range values {
+		value, err := r.parseFilterValue(f, t, v)
+		if err != nil {
+			r.warn(fmt.Sprintf("Invalid value for filter %s - %v", f, err))
+			return qs
+		}
+		params[i] = value
+	}
+	return qs.Filter(fn+"__in", params...)
+}
+
+// parseFilterValue converts a value of a filter to its type, checking the values declared for enums
+func (r *BaseRepository) parseFilterValue(f string, t FieldType, v interface{}) (interface{}, error) {
+	value, err := t.Parse(v)
+	values, ok := r.enumValues[f]
+	if err != nil || t != FieldEnum || !ok {
+		return value, err
+	}
+	for _, allowed := range values {
+		if strings.EqualFold(allowed, value.(string)) {
+			return allowed, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid %s value: %v, expected one of %s", t, v, strings.Join(values, ", "))
+}
+
+func (r *BaseRepository) addTypedFilter(qs orm.QuerySeter, f, fn string, t FieldType, v interface{}) orm.QuerySeter {
+	value, err := r.parseFilterValue(f, t, v)
+	if err != nil {
+		r.warn(fmt.Sprintf("Invalid value for filter %s - %v", f, err))
+		return qs
+	}
+	if _, ok := r.filterMap[f]; ok || t == FieldString {
+		return r.addFilter(qs, f, fn, formatFieldValue(value))
+	}
+	if path, pk, ok := relationId(r.instanceType, fn); ok {
+		return idFilter(qs, path, pk, formatFieldValue(value))
+	}
+	return qs.Filter(fn, value)
+}
+
+// filterType returns the type of a filter field, as declared with AddTypedFilter or else inferred from
+// the entity field, or FieldString if it's unknown
+func (r *BaseRepository) filterType(field string) FieldType {
+	if t, ok := r.fieldTypes[field]; ok {
+		return t
+	}
+	if f, ok := resolveField(r.instanceType, translatePath(r.instanceType, strings.Replace(field, ".", "__", -1))); ok {
+		t, _ := inferFieldType(f.Type)
+		return t
+	}
+	return FieldString
+}
+
+// isIdField tells if a filter field references the id of the entity itself, ex: "id"
+func (r *BaseRepository) isIdField(fn string) bool {
+	f, ok := findField(r.instanceType, fn)
+	return ok && f.Name == r.idField.Name
+}
+
+// idFilter matches an id exactly, converting the value to the type of the id field
+func idFilter(qs orm.QuerySeter, path string, pk entityField, value string) orm.QuerySeter {
+	if t, ok := inferFieldType(pk.Type); ok {
+		if id, err := t.Parse(value); err == nil {
+			return qs.Filter(path, id)
+		}
+	}
+	return qs.Filter(path, value)
+}
+
+func IdFilter(qs orm.QuerySeter, field, value string) orm.QuerySeter {
+	field = strings.TrimSuffix(field, "Id") + "__id"
+	id, _ := strconv.Atoi(value)
+	return qs.Filter(field, id)
+}
+
+func BooleanFilter(qs orm.QuerySeter, field, value string) orm.QuerySeter {
+	return qs.Filter(field, value == "true")
+}
+
+func StartsWithFilter(qs orm.QuerySeter, field, value string) orm.QuerySeter {
+	return qs.Filter(field+"__istartswith", value)
+}
+
+func ContainsWithFilter(qs orm.QuerySeter, field, value string) orm.QuerySeter {
+	return qs.Filter(field+"__icontains", value)
+}
+
+func IExactFilter(qs orm.QuerySeter, field, value string) orm.QuerySeter {
+	return qs.Filter(field+"__iexact", value)
+}
+
+func ExactFilter(qs orm.QuerySeter, field, value string) orm.QuerySeter {
+	return qs.Filter(field+"__exact", value)
+}
+
+func CaseSensitiveStartsWithFilter(qs orm.QuerySeter, field, value string) orm.QuerySeter {
+	return qs.Filter(field+"__startswith", value)
+}
+
+func EndsWithFilter(qs orm.QuerySeter, field, value string) orm.QuerySeter {
+	return qs.Filter(field+"__iendswith", value)
+}
+
+func CaseSensitiveEndsWithFilter(qs orm.QuerySeter, field, value string) orm.QuerySeter {
+	return qs.Filter(field+"__endswith", value)
 }
@@ -0,0 +1,294 @@
+package ngago
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/astaxie/beego/orm"
+)
+
+type Note struct {
+	Id        int64
+	Text      string
+	DeletedAt time.Time `orm:"null"`
+}
+
+func init() {
+	orm.RegisterModel(new(Note))
+}
+
+func TestAddFiltersKeepsTheConditionsOfTheQuery(t *testing.T) {
+	resetBooks(t)
+	r := NewRepository("book", Book{})
+	qs := r.NewQuery().Filter("Available", true)
+	qs = r.AddFilters(qs, []QueryOptions{{Filters: map[string]interface{}{"title": "The"}}})
+	var books []*Book
+	if _, err := qs.All(&books); err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 1 || books[0].Title != "The Hobbit" {
+		t.Errorf("expected only The Hobbit, got %+v", books)
+	}
+}
+
+func TestScopesOrderThePagesWithNoSort(t *testing.T) {
+	resetBooks(t)
+	r := NewRepository("book", Book{})
+	r.AddScope(func(qs orm.QuerySeter) orm.QuerySeter {
+		return qs.OrderBy("-Pages")
+	})
+	tests := []struct {
+		options QueryOptions
+		ids     []int64
+	}{
+		{QueryOptions{}, []int64{3, 2, 1}},
+		{QueryOptions{Max: 10}, []int64{3, 2, 1}},
+		{QueryOptions{Max: 2, Offset: 1}, []int64{2, 1}},
+		{QueryOptions{Max: 10, Sort: "Title"}, []int64{3, 1, 2}},
+	}
+	for _, test := range tests {
+		var books []*Book
+		if err := r.ReadAll(&books, test.options); err != nil {
+			t.Fatal(err)
+		}
+		var ids []int64
+		for _, b := range books {
+			ids = append(ids, b.Id)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(test.ids) {
+			t.Errorf("%+v: expected %v, got %v", test.options, test.ids, ids)
+		}
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	resetBooks(t)
+	r := NewRepository("book", Book{})
+	if err := r.Increment(int64(1), "Pages", 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Increment(int64(9), "Pages", 5); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for a missing book, got %v", err)
+	}
+	if err := r.Increment(int64(1), "Pages", 0); err != nil {
+		t.Errorf("expected no error for a zero delta, got %v", err)
+	}
+	if err := r.Increment(int64(9), "Pages", 0); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for a missing book with a zero delta, got %v", err)
+	}
+	broken := orm.NewOrm()
+	broken.Using("empty")
+	if err := NewRepository("book", Book{}, broken).Increment(int64(1), "Pages", 0); err == nil || err == ErrNotFound {
+		t.Errorf("expected the error of the query, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.SetContext(ctx)
+	if err := r.Increment(int64(1), "Pages", 5); err != context.Canceled {
+		t.Errorf("expected the cancelled context error, got %v", err)
+	}
+	book := &Book{}
+	NewRepository("book", Book{}).Read(int64(1), book)
+	if book.Pages != 315 {
+		t.Errorf("expected 315 pages, got %d", book.Pages)
+	}
+}
+
+func TestCancelledContextsStopTheQueries(t *testing.T) {
+	resetBooks(t)
+	r := NewRepository("book", Book{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.SetContext(ctx)
+	calls := map[string]func() error{
+		"Claim": func() error {
+			return r.Claim(1, func(tx orm.Ormer, claimed interface{}) error { return nil })
+		},
+		"Summary": func() error {
+			_, err := r.Summary(map[string]string{"pages": "sum"})
+			return err
+		},
+		"Aggregate": func() error {
+			_, err := r.Aggregate([]string{"Available"}, map[string]string{"pages": "sum"})
+			return err
+		},
+		"SyncChildren": func() error {
+			return r.SyncChildren(map[string]interface{}{"Author": 1}, []*Book{})
+		},
+	}
+	for name, call := range calls {
+		if err := call(); err != context.Canceled {
+			t.Errorf("%s: expected the cancelled context error, got %v", name, err)
+		}
+	}
+	if count := countRows(t, "book"); count != 3 {
+		t.Errorf("expected the books to be kept, got %d", count)
+	}
+}
+
+func TestSoftDeletedEntitiesAreKeptInTheTable(t *testing.T) {
+	o := orm.NewOrm()
+	o.Raw("DELETE FROM note").Exec()
+	r := NewRepository("note", Note{})
+	r.SoftDelete("DeletedAt")
+	for _, text := range []string{"keep", "delete"} {
+		if _, err := r.Save(&Note{Text: text}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted := &Note{}
+	o.QueryTable("note").Filter("Text", "delete").One(deleted)
+
+	if err := r.Delete(deleted.Id); err != nil {
+		t.Fatal(err)
+	}
+	var notes []*Note
+	if err := r.ReadAll(&notes); err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 1 || notes[0].Text != "keep" {
+		t.Errorf("expected only the kept note to be read, got %+v", notes)
+	}
+	if count, _ := r.Count(); count != 1 {
+		t.Errorf("expected 1 note to be counted, got %d", count)
+	}
+	if err := r.Read(deleted.Id, &Note{}); err != ErrGone {
+		t.Errorf("expected ErrGone reading the deleted note, got %v", err)
+	}
+	if count := countRows(t, "note"); count != 2 {
+		t.Errorf("expected the deleted note to be kept in the table, got %d rows", count)
+	}
+	notes = nil
+	if err := r.ReadAll(&notes, QueryOptions{Deleted: ScopeAll}); err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 2 {
+		t.Errorf("expected the deleted note to be read with ScopeAll, got %+v", notes)
+	}
+}
+
+func TestOrFilterGroupsAreANDedWithTheOtherFilters(t *testing.T) {
+	resetBooks(t)
+	r := NewRepository("book", Book{})
+	tests := []struct {
+		filters map[string]interface{}
+		titles  []string
+	}{
+		{map[string]interface{}{
+			OrFilter: []interface{}{
+				map[string]interface{}{"title": "The Hobbit"},
+				map[string]interface{}{"pages_gte": "400"},
+			},
+		}, []string{"The Hobbit", "Dune"}},
+		{map[string]interface{}{
+			OrFilter: []interface{}{
+				map[string]interface{}{"title": "The Hobbit"},
+				map[string]interface{}{"pages_gte": "400"},
+			},
+			"pages_lt": "400",
+		}, []string{"The Hobbit"}},
+	}
+	for _, test := range tests {
+		var books []*Book
+		if err := r.ReadAll(&books, QueryOptions{Filters: test.filters, Sort: "Id"}); err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, b := range books {
+			titles = append(titles, b.Title)
+		}
+		if fmt.Sprint(titles) != fmt.Sprint(test.titles) {
+			t.Errorf("%v: expected %v, got %v", test.filters, test.titles, titles)
+		}
+	}
+}
+
+// SQLite has no SELECT ... FOR UPDATE SKIP LOCKED, so Claim must fail before calling fn
+func TestClaimIsNotSupportedBySQLite(t *testing.T) {
+	resetBooks(t)
+	called := false
+	err := NewRepository("book", Book{}).Claim(1, func(tx orm.Ormer, claimed interface{}) error {
+		called = true
+		return nil
+	}, QueryOptions{Filters: map[string]interface{}{"Available": true}})
+	if err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("expected a not supported error, got %v", err)
+	}
+	if called {
+		t.Error("expected fn not to be called")
+	}
+}
+
+func TestSyncChildren(t *testing.T) {
+	resetBooks(t)
+	r := NewRepository("book", Book{})
+	tolkien := &Author{Id: 1}
+	desired := []*Book{
+		{Id: 1, Title: "The Hobbit", Pages: 320, Available: true, Author: tolkien},
+		{Title: "Unfinished Tales", Pages: 472, Author: tolkien},
+	}
+	if err := r.SyncChildren(map[string]interface{}{"Author": 1}, desired); err != nil {
+		t.Fatal(err)
+	}
+	var books []*Book
+	if err := r.ReadAll(&books, QueryOptions{Sort: "Id"}); err != nil {
+		t.Fatal(err)
+	}
+	// The Silmarillion is deleted, and Dune, out of the scope, is kept
+	var synced []string
+	for _, b := range books {
+		synced = append(synced, fmt.Sprintf("%s:%d", b.Title, b.Pages))
+	}
+	if expected := "[The Hobbit:320 Dune:412 Unfinished Tales:472]"; fmt.Sprint(synced) != expected {
+		t.Errorf("expected %s, got %v", expected, synced)
+	}
+
+	resetBooks(t)
+	desired = []*Book{{Title: "Unfinished Tales", Author: tolkien}, {Id: 3, Title: "Dune", Author: tolkien}}
+	if err := r.SyncChildren(map[string]interface{}{"Author": 1}, desired); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for a book of another author, got %v", err)
+	}
+	if count := countRows(t, "book"); count != 3 {
+		t.Errorf("expected nothing to be changed, got %d books", count)
+	}
+	book := &Book{}
+	r.Read(int64(3), book)
+	if book.Author == nil || book.Author.Id != 2 {
+		t.Errorf("expected Dune to be kept with its author, got %+v", book)
+	}
+}
+
+func TestDistinct(t *testing.T) {
+	resetBooks(t)
+	r := NewRepository("book", Book{})
+	tests := []struct {
+		field    string
+		options  []QueryOptions
+		expected string
+	}{
+		{"Available", nil, "[false true]"},
+		{"Author.Name", nil, "[Herbert Tolkien]"},
+		{"author__name", []QueryOptions{{Filters: map[string]interface{}{"Available": true}}}, "[Herbert Tolkien]"},
+		{"Author.Name", []QueryOptions{{Filters: map[string]interface{}{"Available": false}}}, "[Tolkien]"},
+		{"Title", []QueryOptions{{Max: 2}}, "[Dune The Hobbit]"},
+		{"Title", []QueryOptions{{Filters: map[string]interface{}{"Pages": "999"}}}, "[]"},
+	}
+	for _, test := range tests {
+		values, err := r.Distinct(test.field, test.options...)
+		if err != nil {
+			t.Errorf("%s: %v", test.field, err)
+			continue
+		}
+		if fmt.Sprint(values) != test.expected {
+			t.Errorf("%s %v: expected %s, got %v", test.field, test.options, test.expected, values)
+		}
+	}
+	for _, field := range []string{"Unknown", "Author.Books"} {
+		if _, err := r.Distinct(field); err == nil {
+			t.Errorf("%s: expected an error", field)
+		}
+	}
+}
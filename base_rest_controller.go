@@ -3,7 +3,9 @@ package ngago
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
+	"reflect"
 	"strconv"
 	"strings"
 
@@ -15,6 +17,15 @@ type RESTController interface {
 	Id(entity interface{}) int64
 }
 
+/*
+Controllers of entities with a primary key that is not an integer, ex: a UUID string, can implement this
+interface to return the id of their entities, instead of Id, which is then not used. The :id route param
+is converted to the type of the repository's IdField, so it's bound as a string for string primary keys
+*/
+type StringIdController interface {
+	StringId(entity interface{}) string
+}
+
 /*
 Controllers can implement this interface as a simple authorization mechanism. The profile should
 be provided by a filter as a Ctx.Input data entry.
@@ -26,6 +37,189 @@ type AuthenticatedController interface {
 	AccessControl(controller, action, url, profile string) bool
 }
 
+/*
+Controllers can implement this interface to authorize requests by the REST operation they perform, ex:
+allowing OpList and OpRead to anyone but OpDelete only to admins, instead of by the beego action names
+received by AccessControl. When a controller implements both interfaces, only AccessOperation is used
+*/
+type OperationAccessController interface {
+	AccessOperation(op Operation, url, profile string) bool
+}
+
+/*
+Controllers can implement this interface to change the key used to return the id of a newly created
+entity in the Post response body, ex: "ID" to return {"ID": 1}. When not implemented, the key is "id"
+*/
+type IdKeyController interface {
+	IdKey() string
+}
+
+/*
+Controllers can implement this interface to customize how the URL of a resource is built from its id,
+ex: for nested or versioned routes. All URLs produced by the controller, like the ones checked with
+AccessControl for Batch operations, are built with it. When not implemented, the URL is the collection
+path of the current route followed by the id, ex: /users/5
+*/
+type ResourceURLController interface {
+	ResourceURL(id interface{}) string
+}
+
+/*
+Controllers can implement this interface to respond to a Post violating a unique constraint with the
+entity it conflicts with, instead of a 500 error, ex: ConflictReturnExisting for "create if it doesn't
+exist, or give me the existing one" flows. The repository must implement ConflictFinder
+*/
+type ConflictController interface {
+	ConflictPolicy() ConflictPolicy
+}
+
+/*
+Controllers can implement this interface to limit how deep clients can paginate, as large offsets make
+the database scan and discard all the skipped rows. Requests for an offset beyond MaxOffset are rejected
+with a 400 error. When not implemented, or when MaxOffset is 0, the offset is not limited
+*/
+type MaxOffsetController interface {
+	MaxOffset() int
+}
+
+/*
+Controllers can implement this interface to let clients select the entities read by scope, when the
+repository soft-deletes them, with the _deleted param or the X-Deleted-Scope header, ex: _deleted=all.
+AllowDeletedScope receives the profile of the current user and must return true when it may read the
+given scope. Requests for ScopeDeleted or ScopeAll are rejected with 401 when not allowed or when this
+interface is not implemented
+*/
+type DeletedScopeController interface {
+	AllowDeletedScope(profile string, scope DeletedScope) bool
+}
+
+/*
+Controllers can implement this interface to do their own per-request setup, ex: reading the tenant from
+the context, without overriding Prepare. AfterPrepare is called at the end of Prepare, after the
+repository is created and the access is checked
+*/
+type AfterPrepareController interface {
+	AfterPrepare()
+}
+
+/*
+Controllers can implement this interface to validate the entities received by Put and Post before they
+are saved. When Validate returns an error, the request is rejected with a 422 and the error message.
+Otherwise, the entity is saved and the warnings, if any, are reported in Warning headers, for issues
+that should be flagged but not block the write, ex: "email domain looks unusual"
+*/
+type ValidatorController interface {
+	Validate(entity interface{}) (warnings []string, err error)
+}
+
+/*
+Controllers can implement this interface to make Post respond with the whole created entity, in the
+requested view, instead of just its id. The entity is read again after it's saved, and after its
+AfterSave hook, so fields set by the database or by the hooks, like timestamps and defaults, are included
+*/
+type ReturnCreatedController interface {
+	ReturnCreated() bool
+}
+
+/*
+Controllers can implement this interface to make Delete respond with a 200 and an empty JSON object, {}, as
+it used to, instead of a 204 (No Content) with no body, for clients that depend on that body
+*/
+type DeleteBodyController interface {
+	DeleteBody() bool
+}
+
+/*
+Controllers can implement this interface to make Put and Patch respond with the entity as it's stored after
+the update, instead of the one received. The entity is read again after it's updated, and after its
+AfterUpdate hook, so columns set by the database or by the hooks, like an UpdatedAt timestamp, are included
+*/
+type ReturnUpdatedController interface {
+	ReturnUpdated() bool
+}
+
+/*
+Controllers can implement this interface to create or update entities with a PUT to the collection URL,
+ex: PUT /users with {"id": 5, ...}, using the repository's Upsert: entities without an id are created,
+with a 201 as Post does, and the others are updated, or created with their id if they don't exist, with
+a 200. The repository must be an Upserter. PUTs to the URL of an entity still only update it
+*/
+type UpsertController interface {
+	Upserts() bool
+}
+
+// DefaultPerPage is the page size used for lists when the request has no _perPage param and the
+// controller doesn't implement PageSizeController. 0 means the lists are only limited by MaxPerPage
+var DefaultPerPage = 0
+
+// Controllers can implement this interface to declare the page size used for their lists when the
+// request has no _perPage param, instead of DefaultPerPage
+type PageSizeController interface {
+	DefaultPerPage() int
+}
+
+/*
+Controllers can implement this interface to skip counting the entities of their lists, ex: for infinite
+scroll UIs that never show a total, as the count can be as expensive as the list itself on big tables. The
+lists are then sent without the X-Total-Count and X-Total-Pages headers. Clients can also skip the count of
+a request with the _noCount=true param
+*/
+type NoCountController interface {
+	SkipCount() bool
+}
+
+// MaxPerPage is the largest page size clients can request for lists, when the controller doesn't implement
+// MaxPageSizeController. Larger _perPage params are clamped to it, with a warning. 0 means no limit. Lists
+// streamed as NDJSON or by StreamControllers are not clamped, and have all the entities with no _perPage
+var MaxPerPage = 500
+
+// Controllers can implement this interface to declare the largest page size of their lists, instead of
+// MaxPerPage, ex: lower for lists of heavy entities
+type MaxPageSizeController interface {
+	MaxPerPage() int
+}
+
+/*
+MaxBodySize is the largest request body, in bytes, accepted by Post, Put, Patch and the other actions
+with a body, when the controller doesn't implement BodySizeController. Larger bodies are rejected with a
+413 before they are decoded. 0 means no limit. Note that beego reads the body before the controller runs,
+up to BConfig.MaxMemory, so that is still the upper bound of the memory used
+*/
+var MaxBodySize int64 = 4 << 20
+
+// Controllers can implement this interface to declare the largest request body they accept, instead of
+// MaxBodySize, ex: higher for endpoints that receive big documents
+type BodySizeController interface {
+	MaxBodySize() int64
+}
+
+/*
+Controllers can implement this interface to be used by browsers from other origins (CORS). The headers
+returned are sent in Access-Control-Expose-Headers, so scripts can read them, usually ExposedHeaders
+plus any custom ones, ex: append(ngago.ExposedHeaders, "X-Request-Id"). Options responds to preflight
+requests, that are not checked with AccessControl, as browsers send them without credentials. The
+Access-Control-Allow-Origin header is left for the CORS middleware
+*/
+type CORSController interface {
+	ExposedHeaders() []string
+}
+
+// ExposedHeaders are the headers sent by BaseRESTController that scripts from other origins need to read
+var ExposedHeaders = []string{"X-Total-Count", "X-Total-Pages", "X-Next-Cursor", "Link", "Warning"}
+
+// allowedMethods are the HTTP methods handled by BaseRESTController, as returned by Options
+var allowedMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+/*
+Controllers can implement this interface to restrict the HTTP methods they support, ex: []string{"GET",
+"HEAD"} for read-only resources. Requests with other methods are rejected with a 405 and the supported
+methods in the Allow header. OPTIONS is always accepted by CORSControllers, for preflight requests.
+Explicitly mapped actions, like Batch, are not affected
+*/
+type MethodsController interface {
+	AllowedMethods() []string
+}
+
 type BaseController struct {
 	beego.Controller
 }
@@ -37,124 +231,947 @@ func (c *BaseController) getData(name string) string {
 	return ""
 }
 
-func (c *BaseController) SendError(code, message string) {
-	c.Data["message"] = message
-	c.Abort(code)
+// ErrorResponse is the JSON body sent by SendError, unless the controller implements ErrorBodyController.
+// Fields has the messages of each invalid field, for requests rejected with a *ValidationError
+type ErrorResponse struct {
+	Error     string            `json:"error"`
+	Code      int               `json:"code"`
+	ErrorCode string            `json:"errorCode,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+/*
+Controllers can implement this interface to change the JSON body of the error responses, to match an
+existing error contract, ex: {"message": "...", "status": 404}. It receives the ErrorResponse that
+would be sent otherwise, with the HTTP status in Code
+*/
+type ErrorBodyController interface {
+	ErrorBody(e ErrorResponse) interface{}
+}
+
+/*
+SendError stops the request, responding with the HTTP status code and a JSON body with the message, by
+default an ErrorResponse, ex: {"error": "user 5 not found", "code": 404}. An application error code can
+be given, to let clients tell apart errors with the same status, ex: "email_taken"
+*/
+func (c *BaseController) SendError(code, message string, errorCode ...string) {
+	status, err := strconv.Atoi(code)
+	if err != nil {
+		status = http.StatusInternalServerError
+	}
+	e := ErrorResponse{Error: message, Code: status}
+	if len(errorCode) > 0 {
+		e.ErrorCode = errorCode[0]
+	}
+	c.sendErrorResponse(e)
+}
+
+// SendInvalid rejects an entity that failed validation with a 422. The messages of a *ValidationError are
+// sent for each field, ex: {"error": "...", "code": 422, "fields": {"email": "is required"}}
+func (c *BaseController) SendInvalid(err error) {
+	e := ErrorResponse{Error: err.Error(), Code: http.StatusUnprocessableEntity}
+	if v, ok := err.(*ValidationError); ok {
+		e.Fields = v.Fields
+	}
+	c.sendErrorResponse(e)
+}
+
+func (c *BaseController) sendErrorResponse(e ErrorResponse) {
+	c.Data["message"] = e.Error
+	var body interface{} = e
+	if ctrl, ok := c.AppController.(ErrorBodyController); ok {
+		body = ctrl.ErrorBody(e)
+	}
+	contentType := "application/json; charset=utf-8"
+	var content []byte
+	var err error
+	if acceptsXML(c.AppController, c.Ctx.Input.Header("Accept")) {
+		contentType = XMLContentType + "; charset=utf-8"
+		content, err = encodeXML("error", represent(body))
+	} else {
+		content, err = c.marshalJSON(body)
+	}
+	if err != nil {
+		c.log().Error(fmt.Sprintf("Error encoding the error response %#v: %v", body, err))
+		c.Abort(strconv.Itoa(e.Code))
+	}
+	c.Ctx.Output.Header("Content-Type", contentType)
+	c.Ctx.ResponseWriter.WriteHeader(e.Code)
+	c.Ctx.ResponseWriter.Write(content)
+	c.StopRun()
 }
 
 type BaseRESTController struct {
 	BaseController
-	repo Repository
+	repo     Repository
+	view     View
+	warnings []string
 }
 
 func (c *BaseRESTController) Prepare() {
 	c.repo = c.AppController.(RESTController).NewRepo()
-	authController, ok := c.AppController.(AuthenticatedController)
-	if !ok {
+	if b, ok := c.repo.(binder); ok {
+		b.bind(c.repo)
+	}
+	if setter, ok := c.repo.(ContextSetter); ok {
+		setter.SetContext(c.Ctx.Request.Context())
+	}
+	if ctrl, ok := c.AppController.(LoggerController); ok {
+		if setter, ok := c.repo.(LoggerSetter); ok {
+			setter.SetLogger(ctrl.Logger())
+		}
+	}
+	cors, isCORS := c.AppController.(CORSController)
+	if isCORS {
+		c.Ctx.Output.Header("Access-Control-Expose-Headers", strings.Join(cors.ExposedHeaders(), ", "))
+	}
+	if !isCORS || c.Ctx.Input.Method() != "OPTIONS" {
+		c.checkMethod()
+		c.checkAccess()
+		c.scopeTenant()
+		c.scopeParent()
+	}
+	c.checkBodySize()
+	c.view = c.parseView()
+	if ctrl, ok := c.AppController.(AfterPrepareController); ok {
+		ctrl.AfterPrepare()
+	}
+}
+
+// methods returns the HTTP methods supported by the controller. OPTIONS is only supported by CORSControllers
+func (c *BaseRESTController) methods() []string {
+	methods := allowedMethods
+	if ctrl, ok := c.AppController.(MethodsController); ok {
+		methods = ctrl.AllowedMethods()
+	}
+	if _, ok := c.AppController.(CORSController); ok {
+		return methods
+	}
+	var supported []string
+	for _, m := range methods {
+		if !strings.EqualFold(m, "OPTIONS") {
+			supported = append(supported, m)
+		}
+	}
+	return supported
+}
+
+// checkMethod rejects the requests with a method not supported by the controller, unless they are mapped to
+// a custom action
+func (c *BaseRESTController) checkMethod() {
+	method := c.Ctx.Input.Method()
+	if _, action := c.GetControllerAndAction(); !strings.EqualFold(action, method) {
 		return
 	}
-	controller, action := c.GetControllerAndAction()
+	if !c.supports(method) {
+		c.methodNotAllowed()
+	}
+}
+
+// supports tells if the HTTP method is supported by the controller
+func (c *BaseRESTController) supports(method string) bool {
+	for _, m := range c.methods() {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// methodNotAllowed responds with a 405 and the methods supported by the controller in the Allow header
+func (c *BaseRESTController) methodNotAllowed() {
+	c.Ctx.Output.Header("Allow", strings.Join(c.methods(), ", "))
+	msg := fmt.Sprintf("Method %s not allowed for %s", c.Ctx.Input.Method(), c.EntityName())
+	c.log().Warn(msg)
+	c.SendError("405", msg)
+}
+
+func (c *BaseRESTController) checkAccess() {
+	_, action := c.GetControllerAndAction()
 	url := c.Ctx.Request.URL.Path
-	user := c.getData("user")
-	profile := c.getData("profile")
-	if !authController.AccessControl(controller, action, url, profile) {
-		beego.Warn(fmt.Sprintf("Access denied! User: %s, Profile: %s, URL: %s", user, profile, url))
+	if !c.allowed(action, url) {
+		user := c.getData("user")
+		profile := c.getData("profile")
+		c.log().Warn(fmt.Sprintf("Access denied! User: %s, Profile: %s, URL: %s", user, profile, url))
 		c.SendError("401", "Access denied!")
 	}
 }
 
+// checkBodySize rejects the requests with a body larger than MaxBodySize, or the controller's limit, with a
+// 413
+func (c *BaseRESTController) checkBodySize() {
+	switch c.Ctx.Input.Method() {
+	case "POST", "PUT", "PATCH":
+	default:
+		return
+	}
+	limit := MaxBodySize
+	if ctrl, ok := c.AppController.(BodySizeController); ok {
+		limit = ctrl.MaxBodySize()
+	}
+	if limit <= 0 {
+		return
+	}
+	if c.Ctx.Request.ContentLength > limit || int64(len(c.Ctx.Input.RequestBody)) > limit {
+		msg := fmt.Sprintf("Request body of %s exceeds the maximum size of %d bytes", c.EntityName(), limit)
+		c.log().Warn(msg)
+		c.SendError("413", msg)
+	}
+}
+
+func (c *BaseRESTController) allowed(action, url string) bool {
+	if ctrl, ok := c.AppController.(OperationAccessController); ok {
+		op := operationOf(action, strings.TrimSuffix(url, "/") != c.collectionURL())
+		return ctrl.AccessOperation(op, url, c.getData("profile"))
+	}
+	authController, ok := c.AppController.(AuthenticatedController)
+	if !ok {
+		return true
+	}
+	controller, _ := c.GetControllerAndAction()
+	return authController.AccessControl(controller, action, url, c.getData("profile"))
+}
+
 func (c *BaseRESTController) Repo() Repository {
 	return c.repo
 }
 
 func (c *BaseRESTController) Get() {
-	var id int64
-	c.Ctx.Input.Bind(&id, ":id")
-	if id != 0 {
+	if id := c.resourceKey(); id != nil {
 		entity := c.repo.NewInstance()
-		err := c.repo.Read(id, entity)
-		if err == ErrNotFound {
-			msg := fmt.Sprintf("%s %d not found", c.EntityName(), id)
-			beego.Warn(msg)
-			c.SendError("404", msg)
+		c.sendReadError(id, c.readEntity(id, entity))
+		data := c.applyView(entity)
+		if c.notModified(entity, data) {
+			return
+		}
+		c.serve(data)
+	} else {
+		options := c.queryOptions()
+		if len(options.Fields) > 0 {
+			view, fields := c.view, c.fieldsView(options.Fields)
+			c.view = func(entity interface{}) interface{} {
+				if view != nil {
+					entity = view(entity)
+				}
+				return fields(entity)
+			}
 		}
+		if ids := c.manyIds(options); ids != nil {
+			c.serveMany(ids)
+			return
+		}
+		if c.wantsCSV() {
+			c.serveCSV(options)
+			return
+		}
+		if acceptsNDJSON(c.Ctx.Input.Header("Accept")) {
+			c.serveNDJSON(options)
+			return
+		}
+		if streamer, ok := c.streamer(); ok {
+			c.serveStream(streamer, options)
+			return
+		}
+		entities := c.repo.NewSlice()
+		err := c.repo.ReadAll(entities, options)
 		if err != nil {
-			beego.Error(fmt.Sprintf("Error reading %ss: %v", c.EntityName(), err))
+			c.log().Error(fmt.Sprintf("Error reading %s: %v", c.EntityName(), err))
 			c.SendError("500", err.Error())
 		}
-		c.Data["json"] = &entity
+		count := int64(-1)
+		if !c.skipsCount() {
+			count, _ = c.repo.Count(options)
+			c.Ctx.Output.Header("X-Total-Count", strconv.FormatInt(count, 10))
+			c.Ctx.Output.Header("X-Total-Pages", strconv.FormatInt(totalPages(count, options.Max), 10))
+		}
+		full := reflect.Indirect(reflect.ValueOf(entities)).Len() == options.Max
+		if link := c.pageLinks(options, count, full); link != "" {
+			c.Ctx.Output.Header("Link", link)
+		}
+		if cursor := c.nextCursor(entities, options); cursor != "" {
+			c.Ctx.Output.Header("X-Next-Cursor", cursor)
+		}
+		c.serve(emptyIfNil(c.applyView(entities)))
+	}
+}
+
+// sendReadError responds with the error of reading the entity addressed by resourceKey, if any: 400 for
+// invalid keys, 410 for deleted entities, 404 for missing ones and 500 for any other error
+func (c *BaseRESTController) sendReadError(id interface{}, err error) {
+	c.sendKeyError(err)
+	if err == ErrGone {
+		msg := fmt.Sprintf("%s %v was deleted", c.EntityName(), id)
+		c.log().Warn(msg)
+		c.SendError("410", msg)
+	}
+	if err == ErrNotFound {
+		msg := fmt.Sprintf("%s %v not found", c.EntityName(), id)
+		c.log().Warn(msg)
+		c.SendError("404", msg)
+	}
+	if err != nil {
+		c.log().Error(fmt.Sprintf("Error reading %ss: %v", c.EntityName(), err))
+		c.SendError("500", err.Error())
+	}
+}
+
+/*
+Head responds with the headers of Get and no body. For a collection, it only counts the entities matching
+the filters, parsed as in Get, setting X-Total-Count and X-Total-Pages, so clients can poll the count
+cheaply. For a single entity, it responds with 200, 404 or 410, as Get would. When the repository is an
+ExistenceChecker, entities addressed by id are only checked with Exists, without reading them, and so
+without an ETag, unless the request has an If-None-Match header, that is then validated as Get does
+*/
+func (c *BaseRESTController) Head() {
+	if id := c.resourceKey(); id != nil {
+		if c.headEntity(id) {
+			return
+		}
 	} else {
-		options := c.parseOptions()
-		entities := c.repo.NewSlice()
-		err := c.repo.ReadAll(entities, options)
+		options := c.queryOptions()
+		count, err := c.repo.Count(options)
 		if err != nil {
-			beego.Error(fmt.Sprintf("Error reading %s: %v", c.EntityName(), err))
+			c.log().Error(fmt.Sprintf("Error counting %s: %v", c.EntityName(), err))
 			c.SendError("500", err.Error())
 		}
-		count, _ := c.repo.Count(options)
 		c.Ctx.Output.Header("X-Total-Count", strconv.FormatInt(count, 10))
-		c.Data["json"] = &entities
+		c.Ctx.Output.Header("X-Total-Pages", strconv.FormatInt(totalPages(count, options.Max), 10))
+	}
+	c.sendWarnings()
+	c.Ctx.Output.SetStatus(http.StatusOK)
+	c.Ctx.Output.Body([]byte{})
+}
+
+// headEntity checks the entity of a Head, returning true when it already responded with a 304 (Not Modified)
+func (c *BaseRESTController) headEntity(id interface{}) bool {
+	checker, ok := c.repo.(ExistenceChecker)
+	if _, isKey := id.(map[string]interface{}); ok && !isKey && c.Ctx.Input.Header("If-None-Match") == "" {
+		exists, err := checker.Exists(id)
+		c.sendReadError(id, err)
+		if exists {
+			return false
+		}
 	}
-	c.ServeJSON()
+	// Missing entities are read too, to tell the deleted ones (410) from the others (404), as Get does
+	entity := c.repo.NewInstance()
+	c.sendReadError(id, c.readEntity(id, entity))
+	return c.notModified(entity, c.applyView(entity))
 }
 
+// Put updates all the columns of the entity in the body. When the request has an :id, bodies with a different
+// id are rejected with a 400, as Patch does
 func (c *BaseRESTController) Put() {
 	entity := c.repo.NewInstance()
-	if err := json.Unmarshal(c.Ctx.Input.RequestBody, entity); err != nil {
-		beego.Error(fmt.Sprintf("Error parsing %s %#v: %v", c.EntityName(), string(c.Ctx.Input.RequestBody), err))
-		c.SendError("422", err.Error())
+	if err := c.decode(c.Ctx.Input.RequestBody, entity); err != nil {
+		c.sendDecodeError(c.Ctx.Input.RequestBody, err)
+	}
+	warnings, err := c.validate(entity)
+	if err != nil {
+		c.log().Warn(fmt.Sprintf("Invalid %s %#v: %v", c.EntityName(), entity, err))
+		c.SendInvalid(err)
+	}
+	for _, w := range warnings {
+		c.warn(w)
+	}
+	if upserter, ok := c.upserter(); ok {
+		c.upsert(upserter, entity)
+		return
+	}
+	c.checkBodyId(c.idParam(), entity)
+	id := c.entityId(entity)
+	err = c.repo.Update(entity)
+	if err == ErrConflict {
+		msg := fmt.Sprintf("%s %v was modified since it was read", c.EntityName(), id)
+		c.log().Warn(msg)
+		c.SendError("409", msg)
+	}
+	if err == ErrNotFound {
+		msg := fmt.Sprintf("%s %v not found", c.EntityName(), id)
+		c.log().Warn(msg)
+		c.SendError("404", msg)
+	}
+	if err != nil {
+		c.log().Error(fmt.Sprintf("Error updating %s %#v: %v", c.EntityName(), entity, err))
+		c.SendError("500", err.Error())
+	}
+	c.readUpdated(id, entity)
+	c.serve(c.applyView(entity))
+}
+
+/*
+Patch partially updates an entity: only the columns of the keys present in the JSON body are updated,
+so omitted fields keep their current values. When the request has an :id, the entity is read first, to
+respond with the whole updated entity, and bodies with a different id are rejected with a 400. The
+repository must implement ColumnMapper
+*/
+func (c *BaseRESTController) Patch() {
+	mapper, ok := c.repo.(ColumnMapper)
+	if !ok {
+		c.SendError("501", fmt.Sprintf("Partial updates not supported for %s", c.EntityName()))
+	}
+	body := c.Ctx.Input.RequestBody
+	keys := c.bodyKeys(body)
+	if keys == nil {
+		msg := fmt.Sprintf("Error parsing %s %#v: a JSON object is expected", c.EntityName(), string(body))
+		c.log().Error(msg)
+		c.SendError("422", msg)
+	}
+	entity := c.repo.NewInstance()
+	id := c.idParam()
+	if id != nil {
+		c.sendReadError(id, c.repo.Read(id, entity))
+	}
+	if err := c.decode(body, entity); err != nil {
+		c.sendDecodeError(body, err)
+	}
+	warnings, err := c.validate(entity)
+	if err != nil {
+		c.log().Warn(fmt.Sprintf("Invalid %s %#v: %v", c.EntityName(), entity, err))
+		c.SendInvalid(err)
+	}
+	for _, w := range warnings {
+		c.warn(w)
+	}
+	c.checkBodyId(id, entity)
+	id = c.entityId(entity)
+	if cols := mapper.Columns(keys...); len(cols) > 0 {
+		err = c.repo.Update(entity, cols...)
+	}
+	if err == ErrConflict {
+		msg := fmt.Sprintf("%s %v was modified since it was read", c.EntityName(), id)
+		c.log().Warn(msg)
+		c.SendError("409", msg)
 	}
-	id := c.GetId(entity)
-	err := c.repo.Update(entity)
 	if err == ErrNotFound {
-		msg := fmt.Sprintf("%s %d not found", c.EntityName(), id)
-		beego.Warn(msg)
+		msg := fmt.Sprintf("%s %v not found", c.EntityName(), id)
+		c.log().Warn(msg)
 		c.SendError("404", msg)
 	}
 	if err != nil {
-		beego.Error(fmt.Sprintf("Error updating %s %#v: %v", c.EntityName(), entity, err))
+		c.log().Error(fmt.Sprintf("Error updating %s %#v: %v", c.EntityName(), entity, err))
 		c.SendError("500", err.Error())
 	}
-	c.Data["json"] = &entity
-	c.ServeJSON()
+	c.readUpdated(id, entity)
+	c.serve(c.applyView(entity))
 }
 
+/*
+Post creates an entity, responding with a 201 (Created) status, the URL of the new entity in the Location
+header, built as the other resource URLs (see ResourceURLController), and its id in the body, ex: {"id": 5},
+or the whole entity for ReturnCreatedControllers
+*/
 func (c *BaseRESTController) Post() {
 	entity := c.repo.NewInstance()
-	if err := json.Unmarshal(c.Ctx.Input.RequestBody, entity); err != nil {
-		beego.Error(fmt.Sprintf("Error parsing %s %#v: %v", c.EntityName(), string(c.Ctx.Input.RequestBody), err))
-		c.SendError("422", err.Error())
+	if err := c.decode(c.Ctx.Input.RequestBody, entity); err != nil {
+		c.sendDecodeError(c.Ctx.Input.RequestBody, err)
+	}
+	warnings, err := c.validate(entity)
+	if err != nil {
+		c.log().Warn(fmt.Sprintf("Invalid %s %#v: %v", c.EntityName(), entity, err))
+		c.SendInvalid(err)
+	}
+	for _, w := range warnings {
+		c.warn(w)
 	}
 	id, err := c.repo.Save(entity)
+	if IsUniqueViolation(err) && c.serveConflict(entity, err) {
+		return
+	}
 	if err != nil {
-		beego.Error(fmt.Sprintf("Error creating %s %#v: %v", c.EntityName(), entity, err))
+		c.log().Error(fmt.Sprintf("Error creating %s %#v: %v", c.EntityName(), entity, err))
 		c.SendError("500", err.Error())
 	}
-	c.Data["json"] = map[string]int64{"id": id}
-	c.ServeJSON()
+	created := c.createdId(entity, id)
+	c.Ctx.Output.Header("Location", c.resourceURL(created))
+	c.Ctx.Output.SetStatus(http.StatusCreated)
+	if ctrl, ok := c.AppController.(ReturnCreatedController); ok && ctrl.ReturnCreated() {
+		if err := c.repo.Read(created, entity); err != nil {
+			c.log().Error(fmt.Sprintf("Error reading created %s %v: %v", c.EntityName(), created, err))
+		}
+		c.serve(c.applyView(entity))
+		return
+	}
+	c.serve(map[string]interface{}{c.idKey(): created})
+}
+
+// upserter returns the repository's Upserter for PUTs to the collection URL of UpsertControllers
+func (c *BaseRESTController) upserter() (Upserter, bool) {
+	ctrl, ok := c.AppController.(UpsertController)
+	if !ok || !ctrl.Upserts() || c.Ctx.Input.Param(":id") != "" {
+		return nil, false
+	}
+	upserter, ok := c.repo.(Upserter)
+	return upserter, ok
+}
+
+func (c *BaseRESTController) upsert(upserter Upserter, entity interface{}) {
+	created := isZeroId(c.entityId(entity))
+	id, err := upserter.Upsert(entity)
+	if IsUniqueViolation(err) && c.serveConflict(entity, err) {
+		return
+	}
+	if err != nil {
+		c.log().Error(fmt.Sprintf("Error saving %s %#v: %v", c.EntityName(), entity, err))
+		c.SendError("500", err.Error())
+	}
+	saved := c.createdId(entity, id)
+	if created {
+		c.Ctx.Output.Header("Location", c.resourceURL(saved))
+		c.Ctx.Output.SetStatus(http.StatusCreated)
+	}
+	c.readUpdated(saved, entity)
+	c.serve(c.applyView(entity))
 }
 
+// checkBodyId rejects with a 400 the bodies with an id other than the one of the URL, if any. The access was
+// checked for the URL, so the body can't move the update to another entity
+func (c *BaseRESTController) checkBodyId(id interface{}, entity interface{}) {
+	if bodyId := c.entityId(entity); id != nil && fmt.Sprint(bodyId) != fmt.Sprint(id) {
+		msg := fmt.Sprintf("Id %v of the body doesn't match the %s %v of the URL", bodyId, c.EntityName(), id)
+		c.log().Warn(msg)
+		c.SendError("400", msg)
+	}
+}
+
+// readUpdated reads an updated entity again for ReturnUpdatedControllers, keeping the received one if
+// it can't be read
+func (c *BaseRESTController) readUpdated(id interface{}, entity interface{}) {
+	ctrl, ok := c.AppController.(ReturnUpdatedController)
+	if !ok || !ctrl.ReturnUpdated() {
+		return
+	}
+	if err := c.repo.Read(id, entity); err != nil {
+		c.log().Error(fmt.Sprintf("Error reading updated %s %v: %v", c.EntityName(), id, err))
+	}
+}
+
+// Delete deletes an entity, responding with a 204 (No Content), or with a 200 and {} for
+// DeleteBodyControllers. Requests without an id, or with a zero id, are rejected with a 400, and missing
+// entities with a 404
 func (c *BaseRESTController) Delete() {
-	var id int64
-	c.Ctx.Input.Bind(&id, ":id")
-	err := c.repo.Delete(id)
+	id := c.resourceKey()
+	if id == nil {
+		msg := fmt.Sprintf("No id of %s to delete", c.EntityName())
+		c.log().Warn(msg)
+		c.SendError("400", msg)
+	}
+	err := c.deleteEntity(id)
+	c.sendKeyError(err)
 	if err == ErrNotFound {
-		msg := fmt.Sprintf("%s %d not found", c.EntityName(), id)
-		beego.Warn(msg)
+		msg := fmt.Sprintf("%s %v not found", c.EntityName(), id)
+		c.log().Warn(msg)
 		c.SendError("404", msg)
 	}
 	if err != nil {
-		beego.Error(fmt.Sprintf("Error deleting %s %d: %v", c.EntityName(), id, err))
+		c.log().Error(fmt.Sprintf("Error deleting %s %v: %v", c.EntityName(), id, err))
+		c.SendError("500", err.Error())
+	}
+	if c.deleteBody() {
+		c.serve(map[string]string{})
+		return
+	}
+	c.sendWarnings()
+	c.Ctx.Output.SetStatus(http.StatusNoContent)
+	c.Ctx.Output.Body([]byte{})
+}
+
+func (c *BaseRESTController) deleteBody() bool {
+	ctrl, ok := c.AppController.(DeleteBodyController)
+	return ok && ctrl.DeleteBody()
+}
+
+/*
+Options responds to OPTIONS requests, ex: CORS preflight requests, with the allowed methods in the Allow
+and Access-Control-Allow-Methods headers, and no body. It's only enabled for CORSControllers, otherwise
+it responds with a 405
+*/
+func (c *BaseRESTController) Options() {
+	if _, ok := c.AppController.(CORSController); !ok {
+		c.methodNotAllowed()
+	}
+	methods := strings.Join(c.methods(), ", ")
+	c.Ctx.Output.Header("Allow", methods)
+	c.Ctx.Output.Header("Access-Control-Allow-Methods", methods)
+	c.Ctx.Output.SetStatus(http.StatusNoContent)
+	c.Ctx.Output.Body([]byte{})
+}
+
+// validate checks the entity with the ValidatorController and then with its own Validator
+func (c *BaseRESTController) validate(entity interface{}) ([]string, error) {
+	var warnings []string
+	if ctrl, ok := c.AppController.(ValidatorController); ok {
+		var err error
+		if warnings, err = ctrl.Validate(entity); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := entity.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return warnings, nil
+}
+
+// serveConflict responds with the entity conflicting with entity, when enabled by the ConflictController,
+// returning false if it didn't respond
+func (c *BaseRESTController) serveConflict(entity interface{}, cause error) bool {
+	ctrl, ok := c.AppController.(ConflictController)
+	if !ok || ctrl.ConflictPolicy() == ConflictFail {
+		return false
+	}
+	finder, ok := c.repo.(ConflictFinder)
+	if !ok {
+		return false
+	}
+	existing := c.repo.NewInstance()
+	if err := finder.FindConflict(entity, existing); err != nil {
+		c.log().Warn(fmt.Sprintf("Could not find the %s conflicting with %#v: %v", c.EntityName(), entity, err))
+		return false
+	}
+	c.log().Warn(fmt.Sprintf("Conflict creating %s: %v", c.EntityName(), cause))
+	if ctrl.ConflictPolicy() == ConflictReport {
+		c.Ctx.Output.SetStatus(http.StatusConflict)
+	}
+	c.serve(c.applyView(existing))
+	return true
+}
+
+/*
+Summary responds with aggregates computed over the filtered entities. The aggregates are specified by
+the _summary param, a JSON object mapping each result key to an aggregate expression, ex:
+_summary={"totalAmount":"sum(amount)","orders":"count(*)"}. It must be mapped explicitly, ex:
+
+	beego.Router("/orders/_summary", &OrderController{}, "get:Summary")
+*/
+func (c *BaseRESTController) Summary() {
+	summarizer, ok := c.repo.(Summarizer)
+	if !ok {
+		c.SendError("501", fmt.Sprintf("Summary not supported for %s", c.EntityName()))
+	}
+	fields := make(map[string]string)
+	if err := json.Unmarshal([]byte(c.GetString("_summary")), &fields); err != nil || len(fields) == 0 {
+		msg := fmt.Sprintf("Invalid summary specification: %#v", c.GetString("_summary"))
+		c.log().Warn(msg)
+		c.SendError("400", msg)
+	}
+	if _, _, err := parseAggregates(fields); err != nil {
+		c.log().Warn(err.Error())
+		c.SendError("400", err.Error())
+	}
+	result, err := summarizer.Summary(fields, c.queryOptions())
+	if err != nil {
+		c.log().Error(fmt.Sprintf("Error summarizing %s: %v", c.EntityName(), err))
+		c.SendError("500", err.Error())
+	}
+	c.serve(result)
+}
+
+/*
+Aggregate responds with aggregates computed for each group of the filtered entities, as a list. The groups
+are specified by the _groupBy param, a comma separated list of fields, and the aggregates by the _aggregates
+param, in the same format as the _summary param of Summary, ex:
+_groupBy=status&_aggregates={"total":"sum(amount)","orders":"count(*)"}. It must be mapped explicitly, ex:
+
+	beego.Router("/orders/_aggregate", &OrderController{}, "get:Aggregate")
+*/
+func (c *BaseRESTController) Aggregate() {
+	aggregator, ok := c.repo.(Aggregator)
+	if !ok {
+		c.SendError("501", fmt.Sprintf("Aggregates not supported for %s", c.EntityName()))
+	}
+	var groupBy []string
+	for _, f := range strings.Split(c.GetString("_groupBy"), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			groupBy = append(groupBy, f)
+		}
+	}
+	aggregates := make(map[string]string)
+	if err := json.Unmarshal([]byte(c.GetString("_aggregates")), &aggregates); err != nil || len(aggregates) == 0 || len(groupBy) == 0 {
+		msg := fmt.Sprintf("Invalid aggregate specification: _groupBy=%#v, _aggregates=%#v", c.GetString("_groupBy"), c.GetString("_aggregates"))
+		c.log().Warn(msg)
+		c.SendError("400", msg)
+	}
+	if _, _, err := parseAggregates(aggregates); err != nil {
+		c.log().Warn(err.Error())
+		c.SendError("400", err.Error())
+	}
+	t := reflect.TypeOf(c.repo.NewInstance())
+	for _, f := range groupBy {
+		if _, ok := resolveField(t, strings.Replace(f, ".", "__", -1)); !ok {
+			msg := fmt.Sprintf("Unknown group by field %s for %s", f, c.EntityName())
+			c.log().Warn(msg)
+			c.SendError("400", msg)
+		}
+	}
+	result, err := aggregator.Aggregate(groupBy, aggregates, c.queryOptions())
+	if err != nil {
+		c.log().Error(fmt.Sprintf("Error aggregating %s: %v", c.EntityName(), err))
+		c.SendError("500", err.Error())
+	}
+	c.serve(result)
+}
+
+/*
+Distinct responds with the distinct values of the field given by the _field param among the filtered
+entities, sorted, ex: GET /orders/_distinct?_field=status&userId=5 -> ["new", "paid"], to fill the
+options of filters in the UIs. The field is referenced by its JSON key, and fields of relations with a
+dotted path, ex: user.name. The number of values is limited by _perPage, as lists are, and by
+MaxDistinctValues. It must be mapped explicitly, ex:
+
+	beego.Router("/orders/_distinct", &OrderController{}, "get:Distinct")
+*/
+func (c *BaseRESTController) Distinct() {
+	reader, ok := c.repo.(DistinctReader)
+	if !ok {
+		c.SendError("501", fmt.Sprintf("Distinct values not supported for %s", c.EntityName()))
+	}
+	field := strings.TrimSpace(c.GetString("_field"))
+	if ctrl, ok := c.AppController.(FieldMapController); ok {
+		for k, name := range ctrl.FieldMap() {
+			if name == field {
+				field = k
+			}
+		}
+	}
+	t := reflect.TypeOf(c.repo.NewInstance())
+	path := strings.Replace(field, ".", "__", -1)
+	if _, ok := resolveField(t, path); !ok || isToMany(t, path) {
+		msg := fmt.Sprintf("Invalid distinct field %#v for %s", c.GetString("_field"), c.EntityName())
+		c.log().Warn(msg)
+		c.SendError("400", msg)
+	}
+	values, err := reader.Distinct(field, c.queryOptions())
+	if err != nil {
+		c.log().Error(fmt.Sprintf("Error reading distinct %s of %s: %v", field, c.EntityName(), err))
 		c.SendError("500", err.Error())
 	}
-	c.Data["json"] = map[string]string{}
-	c.ServeJSON()
+	c.serve(values)
+}
+
+/*
+Permissions responds with the HTTP methods the current profile may use on the resource, as decided by
+AccessControl for each corresponding action, ex: {"DELETE":false,"GET":true,"PATCH":true,"POST":true,
+"PUT":true}. The URL checked is the collection path, the request path without the trailing
+"/_permissions". Methods the controller doesn't support, see MethodsController, are always false. It must
+be mapped explicitly, and AccessControl must allow its "Permissions" action, ex:
+
+	beego.Router("/users/_permissions", &UserController{}, "get:Permissions")
+*/
+func (c *BaseRESTController) Permissions() {
+	url := c.collectionURL()
+	permissions := make(map[string]bool)
+	for _, action := range []string{"Get", "Post", "Put", "Patch", "Delete"} {
+		permissions[strings.ToUpper(action)] = c.supports(action) && c.allowed(action, url)
+	}
+	c.serve(permissions)
+}
+
+/*
+serve sends data as the JSON response, flattening ORM null types (sql.NullString, etc) to their values,
+or as msgpack when requested with "Accept: application/msgpack", or as XML for XMLControllers.
+The warnings collected while processing the request, like ignored filters or sort fields, are sent as
+Warning headers, ex: Warning: 199 - "Unknown sort field foo ignored"
+*/
+func (c *BaseRESTController) serve(data interface{}) {
+	c.sendWarnings()
+	if acceptsMsgpack(c.Ctx.Input.Header("Accept")) {
+		body, err := encodeMsgpack(data)
+		if err == nil {
+			c.Ctx.Output.Header("Content-Type", MsgpackContentType)
+			c.Ctx.Output.Header("Vary", "Accept")
+			c.Ctx.Output.Body(body)
+			return
+		}
+		c.log().Error(fmt.Sprintf("Error encoding %s response as msgpack, sending JSON instead: %v", c.EntityName(), err))
+	}
+	if acceptsXML(c.AppController, c.Ctx.Input.Header("Accept")) {
+		body, err := encodeXML("response", data)
+		if err == nil {
+			c.Ctx.Output.Header("Content-Type", XMLContentType+"; charset=utf-8")
+			c.Ctx.Output.Header("Vary", "Accept")
+			c.Ctx.Output.Body(body)
+			return
+		}
+		c.log().Error(fmt.Sprintf("Error encoding %s response as XML, sending JSON instead: %v", c.EntityName(), err))
+	}
+	body, err := c.marshalJSON(data)
+	if err != nil {
+		c.log().Error(fmt.Sprintf("Error encoding %s response: %v", c.EntityName(), err))
+		c.SendError("500", err.Error())
+	}
+	c.Ctx.Output.Header("Content-Type", "application/json; charset=utf-8")
+	c.Ctx.Output.Body(body)
+}
+
+func (c *BaseRESTController) sendWarnings() {
+	warnings := c.warnings
+	if reporter, ok := c.repo.(WarningReporter); ok {
+		warnings = append(warnings, reporter.Warnings()...)
+	}
+	sent := make(map[string]bool)
+	for _, w := range warnings {
+		if !sent[w] {
+			sent[w] = true
+			c.Ctx.ResponseWriter.Header().Add("Warning", fmt.Sprintf("199 - %q", w))
+		}
+	}
+}
+
+/*
+pageLinks builds the Link header with the first, prev, next and last pages of a list, ex:
+</users?_page=3&_perPage=10>; rel="next". The URLs keep all the other params of the request, like filters
+and sorting. There are no links when the list is not paginated. When the total is not counted (-1), there
+is no last page link, and the next page link is added when the current page is full
+*/
+func (c *BaseRESTController) pageLinks(options QueryOptions, total int64, full bool) string {
+	if options.Max <= 0 || options.After != "" {
+		return ""
+	}
+	page := int64(options.Offset/options.Max + 1)
+	last := totalPages(total, options.Max)
+	if total < 0 {
+		last = page
+		if full {
+			last = page + 1
+		}
+	}
+	if last == 0 {
+		last = 1
+	}
+	link := func(n int64, rel string) string {
+		params := c.Ctx.Request.URL.Query()
+		params.Set("_page", strconv.FormatInt(n, 10))
+		params.Set("_perPage", strconv.Itoa(options.Max))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, c.Ctx.Request.URL.Path, params.Encode(), rel)
+	}
+	links := []string{link(1, "first")}
+	if page > 1 {
+		links = append(links, link(min64(page-1, last), "prev"))
+	}
+	if page < last {
+		links = append(links, link(page+1, "next"))
+	}
+	if total >= 0 {
+		links = append(links, link(last, "last"))
+	}
+	return strings.Join(links, ", ")
+}
+
+// skipsCount tells if the total of the list is not counted, as requested by the client or the controller
+func (c *BaseRESTController) skipsCount() bool {
+	if skip, _ := c.GetBool("_noCount"); skip {
+		return true
+	}
+	ctrl, ok := c.AppController.(NoCountController)
+	return ok && ctrl.SkipCount()
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (c *BaseRESTController) warn(msg string) {
+	c.log().Warn(msg)
+	c.warnings = append(c.warnings, msg)
+}
+
+func (c *BaseRESTController) resourceURL(id interface{}) string {
+	if ctrl, ok := c.AppController.(ResourceURLController); ok {
+		return ctrl.ResourceURL(id)
+	}
+	return fmt.Sprintf("%s/%v", c.collectionURL(), id)
+}
+
+// collectionURL returns the request path without the id of the resource or the name of an explicitly
+// mapped action, like _batch or _permissions
+func (c *BaseRESTController) collectionURL() string {
+	path := strings.TrimSuffix(c.Ctx.Request.URL.Path, "/")
+	if id := c.Ctx.Input.Param(":id"); id != "" {
+		return strings.TrimSuffix(path, "/"+id)
+	}
+	if key := c.keyParam(); key != nil {
+		for trimmed := true; trimmed; {
+			trimmed = false
+			for _, value := range key {
+				if s := value.(string); strings.HasSuffix(path, "/"+s) {
+					path, trimmed = strings.TrimSuffix(path, "/"+s), true
+				}
+			}
+		}
+		return path
+	}
+	if i := strings.LastIndex(path, "/"); i >= 0 && strings.HasPrefix(path[i+1:], "_") {
+		return path[:i]
+	}
+	return path
 }
 
 func (c *BaseRESTController) GetId(entity interface{}) int64 {
 	return c.AppController.(RESTController).Id(entity)
 }
 
+// entityId returns the id of the entity, as a string if the controller is a StringIdController
+func (c *BaseRESTController) entityId(entity interface{}) interface{} {
+	if ctrl, ok := c.AppController.(StringIdController); ok {
+		return ctrl.StringId(entity)
+	}
+	return c.GetId(entity)
+}
+
+// createdId returns the id of a newly created entity: the one returned by Save, unless the controller is
+// a StringIdController, as Save only returns auto-generated integer ids
+func (c *BaseRESTController) createdId(entity interface{}, saved int64) interface{} {
+	if ctrl, ok := c.AppController.(StringIdController); ok {
+		return ctrl.StringId(entity)
+	}
+	return saved
+}
+
+// idParam returns the :id route param converted to the type of the repository's primary key, or nil if
+// there's none, or it's 0 or empty. Invalid ids are rejected with a 400
+func (c *BaseRESTController) idParam() interface{} {
+	param := c.Ctx.Input.Param(":id")
+	if param == "" {
+		return nil
+	}
+	id, err := c.parseId(param)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid id %#v for %s", param, c.EntityName())
+		c.log().Warn(msg)
+		c.SendError("400", msg)
+	}
+	if isZeroId(id) {
+		return nil
+	}
+	return id
+}
+
+// parseId converts an id to the type of the repository's primary key, ex: int64 for an integer field
+func (c *BaseRESTController) parseId(value string) (interface{}, error) {
+	f, ok := findField(reflect.TypeOf(c.repo.NewInstance()), c.repo.IdField())
+	if !ok {
+		return strconv.ParseInt(value, 10, 64)
+	}
+	switch f.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(value, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(value, 10, 64)
+	}
+	return value, nil
+}
+
+func (c *BaseRESTController) idKey() string {
+	if ctrl, ok := c.AppController.(IdKeyController); ok {
+		return ctrl.IdKey()
+	}
+	return "id"
+}
+
 func (c *BaseRESTController) EntityName() string {
 	return c.repo.EntityName()
 }
@@ -164,32 +1181,128 @@ func (c *BaseRESTController) parseFilters() map[string]interface{} {
 	filters := make(map[string]interface{})
 	if filterStr != "" {
 		filterStr, _ = url.QueryUnescape(filterStr)
-		if err := json.Unmarshal([]byte(filterStr), &filters); err != nil {
-			beego.Warn("Invalid filter specification:", filterStr, "-", err.Error())
+		dec := json.NewDecoder(strings.NewReader(filterStr))
+		dec.UseNumber()
+		if err := dec.Decode(&filters); err != nil {
+			c.warn(fmt.Sprintf("Invalid filter specification: %s - %v", filterStr, err))
 		}
 	}
 	for k, v := range c.Input() {
 		if strings.HasPrefix(k, "_") {
 			continue
 		}
-		filters[k] = v[0]
+		if len(v) > 1 {
+			values := make([]interface{}, len(v))
+			for i, item := range v {
+				values[i] = item
+			}
+			filters[k] = values
+		} else {
+			filters[k] = v[0]
+		}
 	}
 	return filters
 }
 
+func (c *BaseRESTController) queryOptions() QueryOptions {
+	options := c.parseOptions()
+	if ctrl, ok := c.AppController.(MaxOffsetController); ok && ctrl.MaxOffset() > 0 && options.Offset > ctrl.MaxOffset() {
+		msg := fmt.Sprintf("Offset %d exceeds the maximum of %d for %s. Use filters to narrow the results, or cursor pagination",
+			options.Offset, ctrl.MaxOffset(), c.EntityName())
+		c.log().Warn(msg)
+		c.SendError("400", msg)
+	}
+	if validator, ok := c.repo.(OptionsValidator); ok {
+		if err := validator.ValidateOptions(options); err != nil {
+			c.log().Warn(fmt.Sprintf("Invalid query for %s: %v", c.EntityName(), err))
+			c.SendError("400", err.Error())
+		}
+	}
+	return options
+}
+
+func (c *BaseRESTController) parseDeletedScope() DeletedScope {
+	value := c.GetString("_deleted")
+	if value == "" {
+		value = c.Ctx.Input.Header("X-Deleted-Scope")
+	}
+	if value == "" {
+		return ScopeActive
+	}
+	scope, err := ParseDeletedScope(value)
+	if err != nil {
+		c.log().Warn(err.Error())
+		c.SendError("400", err.Error())
+	}
+	if scope == ScopeActive {
+		return scope
+	}
+	ctrl, ok := c.AppController.(DeletedScopeController)
+	if !ok || !ctrl.AllowDeletedScope(c.getData("profile"), scope) {
+		msg := fmt.Sprintf("Access denied to the %s %s entities! Profile: %s", scope, c.EntityName(), c.getData("profile"))
+		c.log().Warn(msg)
+		c.SendError("401", "Access denied!")
+	}
+	return scope
+}
+
+// intParam parses an integer request param, responding with a 400 if it's not a number or it's lower than min
+func (c *BaseRESTController) intParam(name string, min int) int {
+	value := c.Input().Get(name)
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < min {
+		msg := fmt.Sprintf("Invalid %s %#v: must be an integer greater than or equal to %d", name, value, min)
+		c.log().Warn(msg)
+		c.SendError("400", msg)
+	}
+	return n
+}
+
 func (c *BaseRESTController) parseOptions() QueryOptions {
-	perPage, page := 0, 1
-	c.Ctx.Input.Bind(&page, "_page")
-	c.Ctx.Input.Bind(&perPage, "_perPage")
+	perPage, page := DefaultPerPage, 1
+	if ctrl, ok := c.AppController.(PageSizeController); ok {
+		perPage = ctrl.DefaultPerPage()
+	}
+	if c.Input().Get("_page") != "" {
+		page = c.intParam("_page", 1)
+	}
+	// Streamed lists are exports not held in memory, as serveCSV's, so they're not limited to a page
+	streamed := c.streamsList()
+	if streamed {
+		perPage = 0
+	}
+	if c.Input().Get("_perPage") != "" {
+		perPage = c.intParam("_perPage", 0)
+	}
+	maxPerPage := MaxPerPage
+	if ctrl, ok := c.AppController.(MaxPageSizeController); ok {
+		maxPerPage = ctrl.MaxPerPage()
+	}
+	if maxPerPage > 0 && !streamed && (perPage <= 0 || perPage > maxPerPage) {
+		if perPage > maxPerPage {
+			c.warn(fmt.Sprintf("Page size %d exceeds the maximum, clamped to %d", perPage, maxPerPage))
+		}
+		perPage = maxPerPage
+	}
 
 	sortField := c.Input().Get("_sortField")
 	sortDir := c.Input().Get("_sortDir")
+	nulls := c.Input().Get("_nulls")
+	var fields []string
+	if f := c.Input().Get("_fields"); f != "" {
+		fields = strings.Split(f, ",")
+	}
 
 	return QueryOptions{
 		Sort:    sortField,
 		Order:   strings.ToLower(sortDir),
+		Nulls:   strings.ToLower(nulls),
 		Offset:  (page - 1) * perPage,
 		Max:     perPage,
 		Filters: c.parseFilters(),
+		Fields:  fields,
+		Deleted: c.parseDeletedScope(),
+		Search:  strings.TrimSpace(c.Input().Get("_q")),
+		After:   c.Input().Get("_cursor"),
 	}
 }
@@ -0,0 +1,402 @@
+package ngago
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/astaxie/beego"
+)
+
+type CatalogController struct {
+	BookController
+}
+
+func (c *CatalogController) NewRepo() Repository {
+	r := NewRepository("book", Book{})
+	r.AllowSort("Title")
+	r.AllowFilters("Title")
+	return r
+}
+
+type PublicBookController struct {
+	BookController
+}
+
+func (c *PublicBookController) ExposedHeaders() []string {
+	return ExposedHeaders
+}
+
+type ReadOnlyBookController struct {
+	BookController
+}
+
+func (c *ReadOnlyBookController) AllowedMethods() []string {
+	return []string{"GET", "HEAD"}
+}
+
+type LegacyBookController struct {
+	BookController
+}
+
+func (c *LegacyBookController) DeleteBody() bool {
+	return true
+}
+
+type NoteController struct {
+	BaseRESTController
+}
+
+func (c *NoteController) NewRepo() Repository {
+	r := NewRepository("note", Note{})
+	r.SoftDelete("DeletedAt")
+	return r
+}
+
+func (c *NoteController) Id(entity interface{}) int64 {
+	return entity.(*Note).Id
+}
+
+func init() {
+	beego.Router("/catalog", &CatalogController{})
+	beego.Router("/legacy/books/:id", &LegacyBookController{})
+	beego.Router("/notes/:id", &NoteController{})
+	beego.Router("/public/books", &PublicBookController{})
+	beego.Router("/readonly/books/:id", &ReadOnlyBookController{})
+	beego.Router("/readonly/books/_permissions", &ReadOnlyBookController{}, "get:Permissions")
+	beego.Router("/books/_permissions", &BookController{}, "get:Permissions")
+	beego.Router("/books/_distinct", &BookController{}, "get:Distinct")
+}
+
+func decodeBooks(t *testing.T, body []byte) []Book {
+	var books []Book
+	if err := json.Unmarshal(body, &books); err != nil {
+		t.Fatalf("expected a list of books, got %s: %v", body, err)
+	}
+	return books
+}
+
+func TestPatchUpdatesOnlyTheKeysOfTheBody(t *testing.T) {
+	resetBooks(t)
+	w := request("PATCH", "/books/1", `{"Pages":300}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	book := &Book{}
+	NewRepository("book", Book{}).Read(int64(1), book)
+	if book.Pages != 300 || book.Title != "The Hobbit" || !book.Available {
+		t.Errorf("expected only the pages to be updated, got %+v", book)
+	}
+}
+
+func TestPatchRejectsBodiesWithAnotherId(t *testing.T) {
+	resetBooks(t)
+	w := request("PATCH", "/books/1", `{"Id":3,"Pages":1}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	book := &Book{}
+	NewRepository("book", Book{}).Read(int64(3), book)
+	if book.Pages != 412 {
+		t.Errorf("expected book 3 to be kept, got %+v", book)
+	}
+}
+
+func TestPutRejectsBodiesWithAnotherId(t *testing.T) {
+	resetBooks(t)
+	for _, body := range []string{`{"Id":2,"Title":"Hijacked"}`, `{"Title":"Hijacked"}`} {
+		if w := request("PUT", "/books/1", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", body, w.Code, w.Body.String())
+		}
+	}
+	for _, id := range []int64{1, 2} {
+		book := &Book{}
+		NewRepository("book", Book{}).Read(id, book)
+		if book.Title == "Hijacked" {
+			t.Errorf("expected book %d to be kept, got %+v", id, book)
+		}
+	}
+	if w := request("PUT", "/books/1", `{"Id":1,"Title":"There and Back Again","Pages":310}`); w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPatchOfDeletedEntitiesIsGone(t *testing.T) {
+	r := NewRepository("note", Note{})
+	r.SoftDelete("DeletedAt")
+	id, err := r.Save(&Note{Text: "forget"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+	path := "/notes/" + strconv.FormatInt(id, 10)
+	if w := request("PATCH", path, `{"Text":"remember"}`); w.Code != http.StatusGone {
+		t.Errorf("expected 410, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request("PATCH", "/notes/999999", `{"Text":"remember"}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestListFiltersOfAnyJSONType(t *testing.T) {
+	resetBooks(t)
+	tests := []struct {
+		filters string
+		count   int
+	}{
+		{`{"Available":true}`, 2},
+		{`{"Available":false}`, 1},
+		{`{"Title":["Dune","The Hobbit"]}`, 2},
+		{`{"Available":true,"Title":["Dune","The Silmarillion"]}`, 1},
+		{`{"Author":null}`, 0},
+		{`{"Title":{"nested":"object"}}`, 3},
+	}
+	for _, test := range tests {
+		w := request("GET", "/books?_filters="+url.QueryEscape(test.filters), "")
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d: %s", test.filters, w.Code, w.Body.String())
+			continue
+		}
+		if books := decodeBooks(t, w.Body.Bytes()); len(books) != test.count {
+			t.Errorf("%s: expected %d books, got %d", test.filters, test.count, len(books))
+		}
+	}
+}
+
+func TestUnknownSortFieldsAreIgnored(t *testing.T) {
+	resetBooks(t)
+	w := request("GET", "/books?_sortField="+url.QueryEscape("nope; DROP TABLE book"), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Warning") == "" {
+		t.Error("expected a warning for the ignored sort field")
+	}
+	if books := decodeBooks(t, w.Body.Bytes()); len(books) != 3 {
+		t.Errorf("expected 3 books, got %d", len(books))
+	}
+}
+
+func TestSortAndFiltersNotAllowedAreRejected(t *testing.T) {
+	resetBooks(t)
+	tests := []struct {
+		query string
+		code  int
+	}{
+		{"_sortField=title", http.StatusOK},
+		{"_sortField=Pages", http.StatusBadRequest},
+		{"_sortField=nope", http.StatusBadRequest},
+		{"title=Dune", http.StatusOK},
+		{"pages=412", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		w := request("GET", "/catalog?"+test.query, "")
+		if w.Code != test.code {
+			t.Errorf("%s: expected %d, got %d: %s", test.query, test.code, w.Code, w.Body.String())
+			continue
+		}
+		if test.code != http.StatusBadRequest {
+			continue
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["error"] == nil {
+			t.Errorf("%s: expected a JSON error, got %s", test.query, w.Body.String())
+		}
+	}
+}
+
+func TestOptionsListsTheAllowedMethods(t *testing.T) {
+	w := request("OPTIONS", "/public/books", "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	allow := w.Header().Get("Allow")
+	for _, method := range []string{"GET", "POST", "PUT", "DELETE"} {
+		if !strings.Contains(allow, method) {
+			t.Errorf("expected %s in the Allow header, got %q", method, allow)
+		}
+	}
+	if w.Header().Get("Access-Control-Allow-Methods") != allow {
+		t.Errorf("expected the Access-Control-Allow-Methods header to match Allow, got %q", w.Header().Get("Access-Control-Allow-Methods"))
+	}
+}
+
+func TestCORSControllersExposeTheTotalCount(t *testing.T) {
+	resetBooks(t)
+	w := request("GET", "/public/books", "")
+	if exposed := w.Header().Get("Access-Control-Expose-Headers"); !strings.Contains(exposed, "X-Total-Count") {
+		t.Errorf("expected X-Total-Count to be exposed, got %q", exposed)
+	}
+	if w.Header().Get("X-Total-Count") != "3" {
+		t.Errorf("expected X-Total-Count 3, got %q", w.Header().Get("X-Total-Count"))
+	}
+}
+
+func TestOptionsIsNotAllowedWithoutCORS(t *testing.T) {
+	w := request("OPTIONS", "/books", "")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", w.Code)
+	}
+	if w.Header().Get("Access-Control-Expose-Headers") != "" {
+		t.Errorf("expected no CORS headers, got %q", w.Header().Get("Access-Control-Expose-Headers"))
+	}
+}
+
+func TestMalformedPaginationParamsAreRejected(t *testing.T) {
+	resetBooks(t)
+	for _, query := range []string{"_page=-1", "_page=0", "_page=abc", "_perPage=xyz", "_perPage=-5"} {
+		w := request("GET", "/books?"+query, "")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", query, w.Code, w.Body.String())
+			continue
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["error"] == nil {
+			t.Errorf("%s: expected a JSON error, got %s", query, w.Body.String())
+		}
+	}
+	w := request("GET", "/books?_page=2&_perPage=2", "")
+	if books := decodeBooks(t, w.Body.Bytes()); w.Code != http.StatusOK || len(books) != 1 {
+		t.Errorf("expected the last book in page 2, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestEmptyListsAreNotErrors(t *testing.T) {
+	resetBooks(t)
+	w := request("GET", "/books?title=nothing+like+it", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != "[]" {
+		t.Errorf("expected [], got %s", body)
+	}
+	if w.Header().Get("X-Total-Count") != "0" {
+		t.Errorf("expected X-Total-Count 0, got %q", w.Header().Get("X-Total-Count"))
+	}
+	if w := request("GET", "/books/999", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing book, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestUnsupportedMethodsAreRejected(t *testing.T) {
+	resetBooks(t)
+	for _, method := range []string{"PATCH", "PUT", "DELETE"} {
+		w := request(method, "/readonly/books/1", `{"Id":1,"Pages":1}`)
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s: expected 405, got %d: %s", method, w.Code, w.Body.String())
+			continue
+		}
+		if allow := w.Header().Get("Allow"); allow != "GET, HEAD" {
+			t.Errorf("%s: expected the Allow header to be \"GET, HEAD\", got %q", method, allow)
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["error"] == nil {
+			t.Errorf("%s: expected a JSON error, got %s", method, w.Body.String())
+		}
+	}
+	book := &Book{}
+	NewRepository("book", Book{}).Read(int64(1), book)
+	if book.Pages != 310 {
+		t.Errorf("expected the book to be unchanged, got %+v", book)
+	}
+	if w := request("GET", "/readonly/books/1", ""); w.Code != http.StatusOK {
+		t.Errorf("GET: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDeleteRespondsWithNoContent(t *testing.T) {
+	resetBooks(t)
+	w := request("DELETE", "/books/1", "")
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("expected 204 without a body, got %d: %q", w.Code, w.Body.String())
+	}
+	if count := countRows(t, "book"); count != 2 {
+		t.Errorf("expected the book to be deleted, got %d books", count)
+	}
+	w = request("DELETE", "/legacy/books/2", "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "{}" {
+		t.Errorf("expected 200 with {}, got %d: %q", w.Code, w.Body.String())
+	}
+}
+
+func TestDeleteOfMissingEntitiesIsNotFound(t *testing.T) {
+	resetBooks(t)
+	for _, test := range []struct {
+		url  string
+		code int
+	}{
+		{"/books/999", http.StatusNotFound},
+		{"/books/0", http.StatusBadRequest},
+		{"/books", http.StatusBadRequest},
+	} {
+		if w := request("DELETE", test.url, ""); w.Code != test.code {
+			t.Errorf("%s: expected %d, got %d: %s", test.url, test.code, w.Code, w.Body.String())
+		}
+	}
+	if count := countRows(t, "book"); count != 3 {
+		t.Errorf("expected the books to be kept, got %d books", count)
+	}
+}
+
+func TestDeleteOfSoftDeletedEntitiesIsNotFound(t *testing.T) {
+	id, err := NewRepository("note", Note{}).Save(&Note{Text: "remember"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "/notes/" + strconv.FormatInt(id, 10)
+	if w := request("DELETE", path, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	w := request("DELETE", path, "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for the deleted note, got %d: %s", w.Code, w.Body.String())
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["error"] == nil {
+		t.Errorf("expected a JSON error, got %s", w.Body.String())
+	}
+}
+
+func TestPermissionsOnlyReportTheSupportedMethods(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"/books/_permissions", `{"DELETE":true,"GET":true,"PATCH":true,"POST":true,"PUT":true}`},
+		{"/readonly/books/_permissions", `{"DELETE":false,"GET":true,"PATCH":false,"POST":false,"PUT":false}`},
+	}
+	for _, test := range tests {
+		w := request("GET", test.url, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", test.url, w.Code, w.Body.String())
+		}
+		var permissions map[string]bool
+		if err := json.Unmarshal(w.Body.Bytes(), &permissions); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := json.Marshal(permissions); string(got) != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.url, test.expected, got)
+		}
+	}
+}
+
+func TestDistinctRespondsWithTheValuesOfTheFilteredEntities(t *testing.T) {
+	resetBooks(t)
+	w := request("GET", "/books/_distinct?_field=author.name&pages_gte=400", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != `["Herbert"]` {
+		t.Errorf(`expected ["Herbert"], got %s`, body)
+	}
+	for _, field := range []string{"", "unknown", "author.books"} {
+		if w := request("GET", "/books/_distinct?_field="+field, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d: %s", field, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package ngago
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// BatchOperation is one of the operations sent to the Batch endpoint. Id, a number or a string depending
+// on the primary key, is used by GET and DELETE, Body by POST and PUT. The body of a PUT must have the id of
+// the entity, that must match the Id of the operation, if any
+type BatchOperation struct {
+	Method string          `json:"method"`
+	Id     interface{}     `json:"id,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// BatchResult is the outcome of a BatchOperation, with the status and body the equivalent
+// single request would respond with
+type BatchResult struct {
+	Status   int         `json:"status"`
+	Body     interface{} `json:"body,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Warnings []string    `json:"warnings,omitempty"`
+	// Fields has the messages of each invalid field, when the body was rejected with a *ValidationError
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+var errBatchFailed = errors.New("batch operation failed")
+
+/*
+Batch runs a JSON array of operations, ex: [{"method":"POST","body":{...}},{"method":"DELETE","id":5}],
+responding with an array of BatchResult, in the same order. Each operation is checked with
+AccessControl as its equivalent single request action and URL. With the _atomic=true param, all
+operations run in a single transaction: when one fails, all are rolled back, and every other
+operation reports a 424 (Failed Dependency) status. It must be mapped explicitly, ex:
+
+	beego.Router("/users/_batch", &UserController{}, "post:Batch")
+*/
+func (c *BaseRESTController) Batch() {
+	var operations []BatchOperation
+	dec := json.NewDecoder(bytes.NewReader(c.Ctx.Input.RequestBody))
+	dec.UseNumber()
+	if err := dec.Decode(&operations); err != nil {
+		c.sendDecodeError(c.Ctx.Input.RequestBody, err)
+	}
+	results := make([]BatchResult, len(operations))
+	atomic, _ := c.GetBool("_atomic")
+	runner, ok := c.repo.(interface {
+		inTx(fn func() error) error
+	})
+	if !atomic || !ok {
+		for i, op := range operations {
+			results[i] = c.runOperation(op)
+		}
+		c.serve(results)
+		return
+	}
+
+	err := runner.inTx(func() error {
+		for i, op := range operations {
+			results[i] = c.runOperation(op)
+			if results[i].Status >= http.StatusBadRequest {
+				for j := range results {
+					if j != i {
+						results[j] = BatchResult{Status: http.StatusFailedDependency}
+					}
+				}
+				return errBatchFailed
+			}
+		}
+		return nil
+	})
+	if err != nil && err != errBatchFailed {
+		c.log().Error(fmt.Sprintf("Error running %s batch: %v", c.EntityName(), err))
+		c.SendError("500", err.Error())
+	}
+	c.serve(results)
+}
+
+func (c *BaseRESTController) runOperation(op BatchOperation) BatchResult {
+	method := strings.ToUpper(op.Method)
+	var id interface{}
+	if op.Id != nil {
+		var err error
+		if id, err = c.parseId(fmt.Sprint(op.Id)); err != nil {
+			return BatchResult{Status: http.StatusBadRequest, Error: fmt.Sprintf("Invalid id %v", op.Id)}
+		}
+	}
+	var entity interface{}
+	if method == "POST" || method == "PUT" {
+		entity = c.repo.NewInstance()
+		if err := c.decode(op.Body, entity); err != nil {
+			e := c.decodeError(err)
+			return BatchResult{Status: e.Code, Error: e.Error, Fields: e.Fields}
+		}
+	}
+	if method == "PUT" {
+		// The operation is authorized for the entity it writes, the one with the id of the body
+		bodyId := c.entityId(entity)
+		if isZeroId(bodyId) {
+			return BatchResult{Status: http.StatusBadRequest, Error: fmt.Sprintf("No id in the body of the %s to update", c.EntityName())}
+		}
+		if id != nil && fmt.Sprint(bodyId) != fmt.Sprint(id) {
+			return BatchResult{Status: http.StatusBadRequest, Error: fmt.Sprintf("Id %v of the body doesn't match the %s %v of the operation", bodyId, c.EntityName(), id)}
+		}
+		id = bodyId
+	}
+	url := c.collectionURL()
+	if !isZeroId(id) {
+		url = c.resourceURL(id)
+	}
+	action := strings.Title(strings.ToLower(method))
+	if !c.allowed(action, url) {
+		return BatchResult{Status: http.StatusUnauthorized, Error: "Access denied!"}
+	}
+	if !c.supports(method) {
+		return BatchResult{Status: http.StatusMethodNotAllowed, Error: fmt.Sprintf("Method %s not allowed for %s", method, c.EntityName())}
+	}
+	var err error
+	var result BatchResult
+	var warnings []string
+	switch method {
+	case "GET":
+		entity := c.repo.NewInstance()
+		err = c.repo.Read(id, entity)
+		result = BatchResult{Status: http.StatusOK, Body: c.applyView(entity)}
+	case "POST", "PUT":
+		if warnings, err = c.validate(entity); err != nil {
+			result := BatchResult{Status: http.StatusUnprocessableEntity, Error: err.Error()}
+			if v, ok := err.(*ValidationError); ok {
+				result.Fields = v.Fields
+			}
+			return result
+		}
+		if method == "POST" {
+			var saved int64
+			saved, err = c.repo.Save(entity)
+			result = BatchResult{Status: http.StatusCreated, Body: map[string]interface{}{c.idKey(): c.createdId(entity, saved)}}
+		} else {
+			err = c.repo.Update(entity)
+			result = BatchResult{Status: http.StatusOK, Body: c.applyView(entity)}
+		}
+	case "DELETE":
+		err = c.repo.Delete(id)
+		result = BatchResult{Status: http.StatusNoContent}
+		if c.deleteBody() {
+			result = BatchResult{Status: http.StatusOK}
+		}
+	default:
+		return BatchResult{Status: http.StatusMethodNotAllowed, Error: fmt.Sprintf("Unsupported method %#v", op.Method)}
+	}
+	if err == ErrGone && method == "GET" {
+		return BatchResult{Status: http.StatusGone, Error: fmt.Sprintf("%s %v was deleted", c.EntityName(), id)}
+	}
+	if err == ErrConflict {
+		return BatchResult{Status: http.StatusConflict, Error: fmt.Sprintf("%s %v was modified since it was read", c.EntityName(), id)}
+	}
+	if err == ErrNotFound {
+		return BatchResult{Status: http.StatusNotFound, Error: fmt.Sprintf("%s %v not found", c.EntityName(), id)}
+	}
+	if err != nil {
+		c.log().Error(fmt.Sprintf("Error running %s %s operation: %v", c.EntityName(), method, err))
+		return BatchResult{Status: http.StatusInternalServerError, Error: err.Error()}
+	}
+	result.Warnings = warnings
+	return result
+}
@@ -0,0 +1,111 @@
+package ngago
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/astaxie/beego"
+)
+
+type GuardedBookController struct {
+	BookController
+}
+
+// AccessControl only allows reading the book 2
+func (c *GuardedBookController) AccessControl(controller, action, url, profile string) bool {
+	return action == "Batch" || action == "Get" || url != "/guarded/books/2"
+}
+
+func init() {
+	beego.Router("/books/_batch", &BookController{}, "post:Batch")
+	beego.Router("/guarded/books/_batch", &GuardedBookController{}, "post:Batch")
+}
+
+func batch(t *testing.T, url, operations string) []BatchResult {
+	w := request("POST", url, operations)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var results []BatchResult
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatalf("expected a list of results, got %s: %v", w.Body.String(), err)
+	}
+	return results
+}
+
+func expectStatuses(t *testing.T, results []BatchResult, statuses ...int) {
+	if len(results) != len(statuses) {
+		t.Fatalf("expected %d results, got %+v", len(statuses), results)
+	}
+	for i, status := range statuses {
+		if results[i].Status != status {
+			t.Errorf("operation %d: expected %d, got %+v", i, status, results[i])
+		}
+	}
+}
+
+func TestBatchRunsEachOperation(t *testing.T) {
+	resetBooks(t)
+	results := batch(t, "/books/_batch", `[
+		{"method":"POST","body":{"Title":"Emma","Pages":474}},
+		{"method":"GET","id":3},
+		{"method":"PUT","id":1,"body":{"Id":1,"Title":"The Hobbit","Pages":320}},
+		{"method":"DELETE","id":2},
+		{"method":"DELETE","id":999}
+	]`)
+	expectStatuses(t, results, http.StatusCreated, http.StatusOK, http.StatusOK, http.StatusNoContent, http.StatusNotFound)
+	if body, _ := results[1].Body.(map[string]interface{}); body["Title"] != "Dune" {
+		t.Errorf("expected Dune, got %+v", results[1].Body)
+	}
+	if count := countRows(t, "book"); count != 3 {
+		t.Errorf("expected 3 books, got %d", count)
+	}
+	book := &Book{}
+	NewRepository("book", Book{}).Read(int64(1), book)
+	if book.Pages != 320 {
+		t.Errorf("expected the book to be updated, got %+v", book)
+	}
+}
+
+func TestBatchPutsMustHaveTheIdOfTheOperation(t *testing.T) {
+	resetBooks(t)
+	results := batch(t, "/books/_batch", `[
+		{"method":"PUT","id":1,"body":{"Id":2,"Title":"Hijacked"}},
+		{"method":"PUT","body":{"Title":"Hijacked"}}
+	]`)
+	expectStatuses(t, results, http.StatusBadRequest, http.StatusBadRequest)
+	book := &Book{}
+	NewRepository("book", Book{}).Read(int64(2), book)
+	if book.Title != "The Silmarillion" {
+		t.Errorf("expected book 2 to be kept, got %+v", book)
+	}
+}
+
+func TestBatchOperationsAreAuthorizedForTheEntityWritten(t *testing.T) {
+	resetBooks(t)
+	results := batch(t, "/guarded/books/_batch", `[
+		{"method":"PUT","body":{"Id":2,"Title":"Hijacked"}},
+		{"method":"DELETE","id":2},
+		{"method":"GET","id":2},
+		{"method":"PUT","body":{"Id":3,"Title":"Dune Messiah","Pages":256}}
+	]`)
+	expectStatuses(t, results, http.StatusUnauthorized, http.StatusUnauthorized, http.StatusOK, http.StatusOK)
+	book := &Book{}
+	NewRepository("book", Book{}).Read(int64(2), book)
+	if book.Title != "The Silmarillion" {
+		t.Errorf("expected book 2 to be kept, got %+v", book)
+	}
+}
+
+func TestAtomicBatchesAreRolledBack(t *testing.T) {
+	resetBooks(t)
+	results := batch(t, "/books/_batch?_atomic=true", `[
+		{"method":"DELETE","id":3},
+		{"method":"GET","id":999}
+	]`)
+	expectStatuses(t, results, http.StatusFailedDependency, http.StatusNotFound)
+	if count := countRows(t, "book"); count != 3 {
+		t.Errorf("expected the delete to be rolled back, got %d books", count)
+	}
+}
@@ -0,0 +1,173 @@
+package ngago
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// BulkUpdate is the body of the UpdateMany endpoint: the ids of the entities to update, and the JSON
+// object with the changes applied to all of them
+type BulkUpdate struct {
+	Ids     []interface{}   `json:"ids"`
+	Changes json.RawMessage `json:"changes"`
+}
+
+/*
+UpdateMany applies the same changes to many entities in a single query, ex: to mark a selection of orders
+as shipped, with the body {"ids": [1, 2, 3], "changes": {"Status": "shipped"}}, responding with the number
+of entities updated, ex: {"count": 3}. The changes are decoded as the entity of a Put, and only the keys
+present are updated. The repository must implement BulkUpdater. It must be mapped explicitly, ex:
+
+	beego.Router("/orders/_bulk", &OrderController{}, "put:UpdateMany")
+*/
+func (c *BaseRESTController) UpdateMany() {
+	updater, ok := c.repo.(BulkUpdater)
+	if !ok {
+		c.SendError("501", fmt.Sprintf("Bulk updates not supported for %s", c.EntityName()))
+	}
+	var bulk BulkUpdate
+	dec := json.NewDecoder(bytes.NewReader(c.Ctx.Input.RequestBody))
+	dec.UseNumber()
+	if err := dec.Decode(&bulk); err != nil {
+		c.sendDecodeError(c.Ctx.Input.RequestBody, err)
+	}
+	ids := c.parseIds(bulk.Ids)
+	changes, err := c.decodeChanges(bulk.Changes)
+	if err != nil {
+		c.sendDecodeError(bulk.Changes, err)
+	}
+	count, err := updater.UpdateMany(ids, changes)
+	if err != nil {
+		c.log().Error(fmt.Sprintf("Error updating %s %v: %v", c.EntityName(), ids, err))
+		c.SendError("500", err.Error())
+	}
+	c.serve(map[string]int64{"count": count})
+}
+
+// decodeChanges decodes a JSON object of changes into an entity, returning the values of the fields
+// present, by field name. Relations are set to the id of the related entity
+func (c *BaseRESTController) decodeChanges(body []byte) (map[string]interface{}, error) {
+	keys := c.bodyKeys(body)
+	if keys == nil {
+		return nil, fmt.Errorf("changes must be a JSON object")
+	}
+	entity := c.repo.NewInstance()
+	if err := c.decode(body, entity); err != nil {
+		return nil, err
+	}
+	v := reflect.Indirect(reflect.ValueOf(entity))
+	changes := make(map[string]interface{})
+	for _, f := range jsonFields(v.Type(), keys) {
+		fv := v.FieldByIndex(f.Index)
+		if !isRelation(f) {
+			changes[f.Name] = fv.Interface()
+			continue
+		}
+		changes[f.Name] = nil
+		if related := reflect.Indirect(fv); related.IsValid() {
+			changes[f.Name] = related.FieldByIndex(primaryKey(related.Type()).Index).Interface()
+		}
+	}
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("no known fields to change in %s", body)
+	}
+	return changes, nil
+}
+
+/*
+DeleteMany deletes many entities in a single query, responding with the number of entities deleted, ex:
+{"count": 3}, or a 404 if none was found. The ids are given in repeated id params, ex: ?id=1&id=2&id=3, or
+as a JSON array in the body. Requests without ids are rejected with a 400. The repository must implement
+BulkDeleter. It must be mapped explicitly, ex:
+
+	beego.Router("/orders/_bulk", &OrderController{}, "delete:DeleteMany")
+*/
+func (c *BaseRESTController) DeleteMany() {
+	deleter, ok := c.repo.(BulkDeleter)
+	if !ok {
+		c.SendError("501", fmt.Sprintf("Bulk deletes not supported for %s", c.EntityName()))
+	}
+	var values []interface{}
+	for _, v := range c.Input()["id"] {
+		values = append(values, v)
+	}
+	if body := bytes.TrimSpace(c.Ctx.Input.RequestBody); len(values) == 0 && len(body) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&values); err != nil {
+			c.log().Error(fmt.Sprintf("Error parsing %s ids %#v: %v", c.EntityName(), string(body), err))
+			c.SendError("422", err.Error())
+		}
+	}
+	if len(values) == 0 {
+		msg := fmt.Sprintf("No ids of %s to delete", c.EntityName())
+		c.log().Warn(msg)
+		c.SendError("400", msg)
+	}
+	ids := c.parseIds(values)
+	count, err := deleter.DeleteMany(ids)
+	if err != nil {
+		c.log().Error(fmt.Sprintf("Error deleting %s %v: %v", c.EntityName(), ids, err))
+		c.SendError("500", err.Error())
+	}
+	if count == 0 {
+		msg := fmt.Sprintf("%s %v not found", c.EntityName(), ids)
+		c.log().Warn(msg)
+		c.SendError("404", msg)
+	}
+	c.serve(map[string]int64{"count": count})
+}
+
+// parseIds converts ids from a request to the type of the repository's primary key, rejecting invalid ones
+// with a 422
+func (c *BaseRESTController) parseIds(values []interface{}) []interface{} {
+	ids := make([]interface{}, len(values))
+	for i, v := range values {
+		id, err := c.parseId(fmt.Sprint(v))
+		if err != nil {
+			msg := fmt.Sprintf("Invalid id %v for %s", v, c.EntityName())
+			c.log().Warn(msg)
+			c.SendError("422", msg)
+		}
+		ids[i] = id
+	}
+	return ids
+}
+
+/*
+manyIds returns the ids of a request for many entities by id, ex: ?id=1&id=2 or _filters={"id":[1,2]}, as
+sent by react-admin's getMany, when it's the only filter and the repository is a ManyReader. It returns nil
+for any other request
+*/
+func (c *BaseRESTController) manyIds(options QueryOptions) []interface{} {
+	if _, ok := c.repo.(ManyReader); !ok || len(options.Filters) != 1 {
+		return nil
+	}
+	for k, v := range options.Filters {
+		values, ok := v.([]interface{})
+		if !ok {
+			return nil
+		}
+		f, ok := findField(reflect.TypeOf(c.repo.NewInstance()), k)
+		if k != c.idKey() && (!ok || f.Name != c.repo.IdField()) {
+			return nil
+		}
+		return c.parseIds(values)
+	}
+	return nil
+}
+
+// serveMany responds with the entities with the given ids, in the same order
+func (c *BaseRESTController) serveMany(ids []interface{}) {
+	entities := c.repo.NewSlice()
+	if err := c.repo.(ManyReader).ReadMany(ids, entities); err != nil {
+		c.log().Error(fmt.Sprintf("Error reading %s %v: %v", c.EntityName(), ids, err))
+		c.SendError("500", err.Error())
+	}
+	count := int64(reflect.Indirect(reflect.ValueOf(entities)).Len())
+	c.Ctx.Output.Header("X-Total-Count", strconv.FormatInt(count, 10))
+	c.serve(emptyIfNil(c.applyView(entities)))
+}
@@ -0,0 +1,125 @@
+package ngago
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/orm"
+)
+
+func init() {
+	beego.Router("/books/_bulk", &BookController{}, "put:UpdateMany;delete:DeleteMany")
+}
+
+func TestUpdateMany(t *testing.T) {
+	resetBooks(t)
+	r := NewRepository("book", Book{})
+	count, err := r.UpdateMany([]interface{}{int64(1), int64(3), int64(999)}, map[string]interface{}{"Available": false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 books updated, got %d", count)
+	}
+	if available, _ := r.Count(QueryOptions{Filters: map[string]interface{}{"Available": true}}); available != 0 {
+		t.Errorf("expected no available books, got %d", available)
+	}
+	if count, err := r.UpdateMany(nil, map[string]interface{}{"Available": true}); count != 0 || err != nil {
+		t.Errorf("expected nothing to be updated without ids, got %d, %v", count, err)
+	}
+}
+
+func TestUpdateManyRoute(t *testing.T) {
+	resetBooks(t)
+	w := request("PUT", "/books/_bulk", `{"ids":[1,2],"changes":{"Pages":100,"Author":{"Id":2}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result map[string]int64
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || result["count"] != 2 {
+		t.Errorf("expected 2 books updated, got %s", w.Body.String())
+	}
+	// Only the fields present in the changes are updated
+	book := &Book{}
+	NewRepository("book", Book{}).Read(int64(1), book)
+	if book.Title != "The Hobbit" || book.Pages != 100 || book.Author == nil || book.Author.Id != 2 {
+		t.Errorf("expected the pages and author of the book to be changed, got %+v", book)
+	}
+	for _, body := range []string{`{"ids":[1],"changes":[]}`, `{"ids":[1],"changes":{"Unknown":1}}`, `{"ids":["one"],"changes":{"Pages":1}}`} {
+		if w := request("PUT", "/books/_bulk", body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: expected 422, got %d: %s", body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestDeleteMany(t *testing.T) {
+	resetBooks(t)
+	r := NewRepository("book", Book{})
+	if _, err := r.DeleteMany(nil); err != ErrNoIds {
+		t.Errorf("expected ErrNoIds, got %v", err)
+	}
+	count, err := r.DeleteMany([]interface{}{int64(1), int64(3), int64(999)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 books deleted, got %d", count)
+	}
+	if left := countRows(t, "book"); left != 1 {
+		t.Errorf("expected 1 book left, got %d", left)
+	}
+}
+
+func TestDeleteManyMarksSoftDeletedEntities(t *testing.T) {
+	orm.NewOrm().Raw("DELETE FROM note").Exec()
+	r := NewRepository("note", Note{})
+	r.SoftDelete("DeletedAt")
+	var ids []interface{}
+	for _, text := range []string{"a", "b"} {
+		id, err := r.Save(&Note{Text: text})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if count, err := r.DeleteMany(ids); count != 2 || err != nil {
+		t.Fatalf("expected 2 notes deleted, got %d, %v", count, err)
+	}
+	// The notes already deleted are not counted again
+	if count, err := r.DeleteMany(ids); count != 0 || err != nil {
+		t.Errorf("expected no notes deleted again, got %d, %v", count, err)
+	}
+	if count, _ := r.Count(); count != 0 {
+		t.Errorf("expected no active notes, got %d", count)
+	}
+	if count := countRows(t, "note"); count != 2 {
+		t.Errorf("expected the deleted notes to be kept in the table, got %d rows", count)
+	}
+}
+
+func TestDeleteManyRoute(t *testing.T) {
+	resetBooks(t)
+	tests := []struct {
+		url, body string
+		code      int
+		left      int64
+	}{
+		{"/books/_bulk", "", http.StatusBadRequest, 3},
+		{"/books/_bulk", "[]", http.StatusBadRequest, 3},
+		{"/books/_bulk?id=one", "", http.StatusUnprocessableEntity, 3},
+		{"/books/_bulk?id=998&id=999", "", http.StatusNotFound, 3},
+		{"/books/_bulk?id=1&id=2", "", http.StatusOK, 1},
+		{"/books/_bulk", "[3]", http.StatusOK, 0},
+	}
+	for _, test := range tests {
+		w := request("DELETE", test.url, test.body)
+		if w.Code != test.code {
+			t.Errorf("%s %s: expected %d, got %d: %s", test.url, test.body, test.code, w.Code, w.Body.String())
+		}
+		if left := countRows(t, "book"); left != test.left {
+			t.Errorf("%s %s: expected %d books left, got %d", test.url, test.body, test.left, left)
+		}
+	}
+}
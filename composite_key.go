@@ -0,0 +1,182 @@
+package ngago
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/astaxie/beego/orm"
+)
+
+// KeyError is returned by ReadByKey and DeleteByKey when a field of the composite key is missing or its
+// value is invalid
+type KeyError struct {
+	Field string
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("invalid key field %q", e.Field)
+}
+
+/*
+KeyRepository is implemented by repositories of entities addressed by a composite key, as declared with
+BaseRepository.CompositeKey. The key maps the fields of the composite key to their values, ex:
+{"TenantId": 1, "Code": "abc"}. Values can also be strings, ex: route params, that are converted to the
+types of the fields
+*/
+type KeyRepository interface {
+	ReadByKey(key map[string]interface{}, data interface{}) error
+	DeleteByKey(key map[string]interface{}) error
+}
+
+/*
+CompositeKey declares the fields that identify the entities together, ex: CompositeKey("TenantId", "Code"),
+for tables with a unique key on (tenant_id, code). The orm still requires a single primary key, used by Read,
+Update and Delete; the composite key is used by ReadByKey and DeleteByKey
+*/
+func (r *BaseRepository) CompositeKey(fields ...string) {
+	r.keyFields = nil
+	for _, field := range fields {
+		f, ok := findField(r.instanceType, field)
+		if !ok || isToMany(r.instanceType, f.Name) {
+			panic(fmt.Sprintf("ngago: invalid composite key field %s for %s", field, r.table))
+		}
+		r.keyFields = append(r.keyFields, f)
+	}
+}
+
+// ReadByKey reads the entity with the given composite key, returning ErrNotFound and ErrGone as Read does
+func (r *BaseRepository) ReadByKey(key map[string]interface{}, data interface{}) error {
+	if err := r.ctxErr(); err != nil {
+		return err
+	}
+	qs, err := r.keyQuery(key)
+	if err != nil {
+		return err
+	}
+	return r.readOne(qs, data)
+}
+
+// DeleteByKey deletes the entity with the given composite key, as Delete does
+func (r *BaseRepository) DeleteByKey(key map[string]interface{}) error {
+	if err := r.ctxErr(); err != nil {
+		return err
+	}
+	qs, err := r.keyQuery(key)
+	if err != nil {
+		return err
+	}
+	return r.deleteOne(qs)
+}
+
+// keyQuery filters the table by all the fields of the composite key, returning a *KeyError if any of them
+// is missing from the key, or can't be converted to the type of the field
+func (r *BaseRepository) keyQuery(key map[string]interface{}) (orm.QuerySeter, error) {
+	if len(r.keyFields) == 0 {
+		panic(fmt.Sprintf("ngago: no composite key declared for %s", r.table))
+	}
+	qs := r.query(r.Orm)
+	for _, f := range r.keyFields {
+		value, ok := keyValue(key, f)
+		if !ok {
+			return nil, &KeyError{Field: f.Name}
+		}
+		path := f.Name
+		t := f.Type
+		if isRelation(f) {
+			pk := primaryKey(f.Type)
+			path, t = f.Name+"__"+pk.Name, pk.Type
+		}
+		if ft, ok := inferFieldType(t); ok && isString(value) {
+			parsed, err := ft.Parse(value)
+			if err != nil {
+				return nil, &KeyError{Field: f.Name}
+			}
+			value = parsed
+		}
+		qs = qs.Filter(path, value)
+	}
+	return qs, nil
+}
+
+// keyValue looks up the value of a field of the composite key by its name, column or JSON key
+func keyValue(key map[string]interface{}, f entityField) (interface{}, bool) {
+	for k, v := range key {
+		if strings.EqualFold(k, f.Name) || k == f.Column || k == jsonName(f) {
+			return v, v != nil
+		}
+	}
+	return nil, false
+}
+
+/*
+Controllers of entities with a composite key can implement this interface to map the route params to the
+fields of the key, ex: {":tenant": "TenantId", ":code": "Code"}, for routes like:
+
+	beego.Router("/tenants/:tenant/items/:code", &ItemController{})
+
+Get, Head and Delete then address the entity with ReadByKey and DeleteByKey when all the params are
+present. The repository must be a KeyRepository
+*/
+type KeyParamsController interface {
+	KeyParams() map[string]string
+}
+
+// keyParam returns the composite key of the request, or nil if the controller doesn't declare one, or the
+// request doesn't have all of its params
+func (c *BaseRESTController) keyParam() map[string]interface{} {
+	ctrl, ok := c.AppController.(KeyParamsController)
+	if !ok {
+		return nil
+	}
+	if _, ok := c.repo.(KeyRepository); !ok {
+		return nil
+	}
+	key := make(map[string]interface{})
+	for param, field := range ctrl.KeyParams() {
+		value := c.Ctx.Input.Param(param)
+		if value == "" {
+			return nil
+		}
+		key[field] = value
+	}
+	if len(key) == 0 {
+		return nil
+	}
+	return key
+}
+
+// resourceKey returns the composite key or the id of the requested entity, or nil for collection requests
+func (c *BaseRESTController) resourceKey() interface{} {
+	if key := c.keyParam(); key != nil {
+		return key
+	}
+	if id := c.idParam(); id != nil {
+		return id
+	}
+	return nil
+}
+
+// readEntity reads the entity addressed by resourceKey, by its composite key or its id
+func (c *BaseRESTController) readEntity(id interface{}, entity interface{}) error {
+	if key, ok := id.(map[string]interface{}); ok {
+		return c.repo.(KeyRepository).ReadByKey(key, entity)
+	}
+	return c.repo.Read(id, entity)
+}
+
+// deleteEntity deletes the entity addressed by resourceKey, by its composite key or its id
+func (c *BaseRESTController) deleteEntity(id interface{}) error {
+	if key, ok := id.(map[string]interface{}); ok {
+		return c.repo.(KeyRepository).DeleteByKey(key)
+	}
+	return c.repo.Delete(id)
+}
+
+// sendKeyError responds with a 400 if err is a *KeyError
+func (c *BaseRESTController) sendKeyError(err error) {
+	if e, ok := err.(*KeyError); ok {
+		msg := fmt.Sprintf("Invalid key for %s: %s", c.EntityName(), e.Error())
+		c.log().Warn(msg)
+		c.SendError("400", msg)
+	}
+}
@@ -0,0 +1,128 @@
+package ngago
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/orm"
+)
+
+type Item struct {
+	Id       int64
+	TenantId int64
+	Code     string
+	Name     string
+}
+
+func (i *Item) TableUnique() [][]string {
+	return [][]string{{"TenantId", "Code"}}
+}
+
+type ItemController struct {
+	BaseRESTController
+}
+
+func (c *ItemController) NewRepo() Repository {
+	return newItemRepository()
+}
+
+func (c *ItemController) Id(entity interface{}) int64 {
+	return entity.(*Item).Id
+}
+
+func (c *ItemController) KeyParams() map[string]string {
+	return map[string]string{":tenant": "TenantId", ":code": "Code"}
+}
+
+func init() {
+	orm.RegisterModel(new(Item))
+	beego.Router("/tenants/:tenant/items/:code", &ItemController{})
+}
+
+func newItemRepository() *BaseRepository {
+	r := NewRepository("item", Item{})
+	r.CompositeKey("TenantId", "Code")
+	return r
+}
+
+// resetItems replaces the items with the code "abc" in the tenants 1 (Pen) and 2 (Pencil), and "xyz" in
+// the tenant 1 (Eraser)
+func resetItems(t *testing.T) {
+	o := orm.NewOrm()
+	o.Raw("DELETE FROM item").Exec()
+	for _, i := range []*Item{{1, 1, "abc", "Pen"}, {2, 2, "abc", "Pencil"}, {3, 1, "xyz", "Eraser"}} {
+		if _, err := o.Insert(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadByKey(t *testing.T) {
+	resetItems(t)
+	r := newItemRepository()
+	tests := []struct {
+		key  map[string]interface{}
+		name string
+		err  error
+	}{
+		{map[string]interface{}{"TenantId": int64(2), "Code": "abc"}, "Pencil", nil},
+		{map[string]interface{}{"tenant_id": "1", "code": "abc"}, "Pen", nil},
+		{map[string]interface{}{"TenantId": "2", "Code": "xyz"}, "", ErrNotFound},
+	}
+	for _, test := range tests {
+		item := &Item{}
+		if err := r.ReadByKey(test.key, item); err != test.err {
+			t.Errorf("%v: expected %v, got %v", test.key, test.err, err)
+			continue
+		}
+		if item.Name != test.name {
+			t.Errorf("%v: expected %q, got %+v", test.key, test.name, item)
+		}
+	}
+	for _, key := range []map[string]interface{}{{"Code": "abc"}, {"TenantId": "one", "Code": "abc"}} {
+		if err := r.ReadByKey(key, &Item{}); err == nil {
+			t.Errorf("%v: expected a *KeyError", key)
+		} else if _, ok := err.(*KeyError); !ok {
+			t.Errorf("%v: expected a *KeyError, got %v", key, err)
+		}
+	}
+}
+
+func TestDeleteByKey(t *testing.T) {
+	resetItems(t)
+	if err := newItemRepository().DeleteByKey(map[string]interface{}{"TenantId": 1, "Code": "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if count := countRows(t, "item"); count != 2 {
+		t.Errorf("expected only one item to be deleted, got %d left", count)
+	}
+	if err := newItemRepository().ReadByKey(map[string]interface{}{"TenantId": 2, "Code": "abc"}, &Item{}); err != nil {
+		t.Errorf("expected the item of the tenant 2 to be kept, got %v", err)
+	}
+}
+
+func TestCompositeKeyRoutes(t *testing.T) {
+	resetItems(t)
+	w := request("GET", "/tenants/2/items/abc", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	item := &Item{}
+	if err := json.Unmarshal(w.Body.Bytes(), item); err != nil || item.Name != "Pencil" {
+		t.Errorf("expected the Pencil, got %s", w.Body.String())
+	}
+	if w := request("GET", "/tenants/2/items/xyz", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request("GET", "/tenants/one/items/abc", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request("DELETE", "/tenants/1/items/xyz", ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if count := countRows(t, "item"); count != 2 {
+		t.Errorf("expected the Eraser to be deleted, got %d items left", count)
+	}
+}
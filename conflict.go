@@ -0,0 +1,89 @@
+package ngago
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/astaxie/beego/orm"
+)
+
+// ConflictPolicy tells how a Post violating a unique constraint is responded. See ConflictController
+type ConflictPolicy int
+
+const (
+	// ConflictFail responds with a 500 error, the default
+	ConflictFail ConflictPolicy = iota
+	// ConflictReturnExisting responds with the existing entity and a 200 status
+	ConflictReturnExisting
+	// ConflictReport responds with the existing entity and a 409 (Conflict) status
+	ConflictReport
+)
+
+// ConflictFinder is implemented by repositories that can find the entity a new one conflicts with, as
+// BaseRepository does
+type ConflictFinder interface {
+	FindConflict(entity interface{}, data interface{}) error
+}
+
+// IsUniqueViolation tells if err was caused by a unique constraint violation, for the databases
+// supported by the orm
+func IsUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "unique constraint") || // SQLite, PostgreSQL and Oracle
+		strings.Contains(msg, "duplicate entry") || // MySQL and TiDB
+		strings.Contains(msg, "duplicate key") ||
+		strings.Contains(msg, "sqlstate 23505")
+}
+
+/*
+FindConflict reads into data the existing entity with the same values as entity for any of its unique
+fields, declared with the orm "unique" tag or by a TableUnique method, returning ErrNotFound if there
+is none. Unique relations are matched by their Id, and unique sets that include a nil relation are
+skipped
+*/
+func (r *BaseRepository) FindConflict(entity interface{}, data interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(entity))
+	cond := orm.NewCondition()
+	found := false
+	for _, group := range uniqueFields(v) {
+		g := orm.NewCondition()
+		for _, name := range group {
+			fv := v.FieldByName(name)
+			if !fv.IsValid() || (fv.Kind() == reflect.Ptr && fv.IsNil()) {
+				g = nil
+				break
+			}
+			g = g.And(name, fv.Interface())
+		}
+		if g != nil {
+			cond = cond.OrCond(g)
+			found = true
+		}
+	}
+	if !found {
+		return ErrNotFound
+	}
+	qs := r.query(r.Orm).SetCond(cond)
+	return r.self.One(r.self.PrepareQuery(qs), data)
+}
+
+// uniqueFields lists the sets of field names that must be unique for the entity v
+func uniqueFields(v reflect.Value) [][]string {
+	var groups [][]string
+	for _, f := range entityFields(v.Type()) {
+		for _, t := range strings.Split(strings.ToLower(f.Tag.Get("orm")), ";") {
+			if strings.TrimSpace(t) == "unique" {
+				groups = append(groups, []string{f.Name})
+			}
+		}
+	}
+	if u, ok := v.Addr().Interface().(interface {
+		TableUnique() [][]string
+	}); ok {
+		groups = append(groups, u.TableUnique()...)
+	}
+	return groups
+}
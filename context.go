@@ -0,0 +1,36 @@
+package ngago
+
+import "context"
+
+/*
+ContextSetter is implemented by repositories that honor the context of the request, as BaseRepository
+does. BaseRESTController sets the context of the HTTP request in Prepare, so operations stop when the
+client disconnects or the deadline expires
+*/
+type ContextSetter interface {
+	SetContext(ctx context.Context)
+}
+
+/*
+SetContext sets the context of the repository operations. As the orm doesn't support contexts, queries
+already running are not cancelled: the context is checked before each query, and between the chunks of
+ProcessInChunks and ReadAllStream, returning its error once it's done, ex: context.Canceled
+*/
+func (r *BaseRepository) SetContext(ctx context.Context) {
+	r.ctx = ctx
+}
+
+// Context returns the context set with SetContext, or context.Background() if none was set
+func (r *BaseRepository) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+func (r *BaseRepository) ctxErr() error {
+	if r.ctx == nil {
+		return nil
+	}
+	return r.ctx.Err()
+}
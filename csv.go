@@ -0,0 +1,141 @@
+package ngago
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// CSVContentType is the media type clients send in the Accept header to export lists as CSV. The _format=csv
+// param can be used instead, ex: in download links
+const CSVContentType = "text/csv"
+
+// CSVMaxRows caps the number of entities exported to CSV, as exports ignore pagination. 0 means no limit
+var CSVMaxRows = 100000
+
+func (c *BaseRESTController) wantsCSV() bool {
+	if strings.EqualFold(c.GetString("_format"), "csv") {
+		return true
+	}
+	for _, mediaRange := range strings.Split(c.Ctx.Input.Header("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(mediaRange); err == nil && mediaType == CSVContentType {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+serveCSV exports all the entities matching the filters of the options, in their sort, as a CSV attachment,
+ignoring the pagination, up to CSVMaxRows. The header row has the JSON keys of the entities, the struct
+field names by default, or the keys of the requested view. Relations and other nested values are written
+as JSON. As in serveNDJSON, the entities are read and sent in chunks
+*/
+func (c *BaseRESTController) serveCSV(options QueryOptions) {
+	options.Offset, options.Max, options.After = 0, 0, ""
+	w := csv.NewWriter(c.Ctx.ResponseWriter)
+	var header []string
+	exported := 0
+	for {
+		size := DefaultChunkSize
+		if CSVMaxRows > 0 && CSVMaxRows-exported < size {
+			size = CSVMaxRows - exported
+		}
+		chunkOptions := options
+		chunkOptions.Max = size
+		chunk := c.repo.NewSlice()
+		if err := c.repo.ReadAll(chunk, chunkOptions); err != nil {
+			c.log().Error(fmt.Sprintf("Error reading %s: %v", c.EntityName(), err))
+			if header == nil {
+				c.SendError("500", err.Error())
+			}
+			return
+		}
+		items := reflect.ValueOf(chunk).Elem()
+		for i := 0; i < items.Len(); i++ {
+			item := items.Index(i)
+			if item.Kind() != reflect.Ptr {
+				item = item.Addr()
+			}
+			obj, ok := represent(c.applyView(item.Interface())).(*object)
+			if !ok {
+				c.log().Error(fmt.Sprintf("Error exporting %s: not an object", c.EntityName()))
+				return
+			}
+			if header == nil {
+				header = c.csvHeader(obj)
+				c.startCSV(header)
+				w.Write(header)
+			}
+			row := make([]string, len(header))
+			for j, k := range header {
+				row[j] = csvCell(obj.values[k])
+			}
+			w.Write(row)
+		}
+		if header == nil {
+			header = c.csvHeader(nil)
+			c.startCSV(header)
+			w.Write(header)
+		}
+		if w.Flush(); w.Error() != nil {
+			c.log().Warn(fmt.Sprintf("Error sending %s: %v", c.EntityName(), w.Error()))
+			return
+		}
+		c.Ctx.ResponseWriter.Flush()
+		exported += items.Len()
+		options.Offset += items.Len()
+		if CSVMaxRows > 0 && exported >= CSVMaxRows {
+			c.log().Warn(fmt.Sprintf("Export of %s truncated to %d rows", c.EntityName(), CSVMaxRows))
+			return
+		}
+		if items.Len() < size {
+			return
+		}
+	}
+}
+
+func (c *BaseRESTController) startCSV(header []string) {
+	c.Ctx.Output.Header("Content-Type", CSVContentType+"; charset=utf-8")
+	c.Ctx.Output.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, c.EntityName()))
+	c.sendWarnings()
+	c.Ctx.ResponseWriter.WriteHeader(http.StatusOK)
+}
+
+// csvHeader lists the columns of the export: the JSON keys of the entity fields, except the to-many
+// relations, or the keys of obj, the first entity exported, when a view changes them
+func (c *BaseRESTController) csvHeader(obj *object) []string {
+	if c.entityView() != nil && obj != nil {
+		return obj.Keys()
+	}
+	var header []string
+	for _, f := range entityFields(reflect.TypeOf(c.repo.NewInstance())) {
+		if name := jsonName(f); name != "" && !hasOrmTag(f, "reverse(many)") && !hasOrmTag(f, "rel(m2m)") {
+			header = append(header, name)
+		}
+	}
+	return header
+}
+
+// csvCell formats a value of the generic representation of an entity as a CSV cell
+func csvCell(value interface{}) string {
+	if raw, ok := value.(json.RawMessage); ok {
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return string(raw)
+		}
+	}
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case *object, []interface{}, map[string]interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,69 @@
+package ngago
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/astaxie/beego"
+)
+
+type Product struct {
+	Id    int64
+	Name  string
+	Price float64
+}
+
+var products = NewMemoryRepository("product", Product{})
+
+type ProductController struct {
+	BaseRESTController
+}
+
+func (c *ProductController) NewRepo() Repository {
+	return products
+}
+
+func (c *ProductController) Id(entity interface{}) int64 {
+	return entity.(*Product).Id
+}
+
+func init() {
+	beego.Router("/products", &ProductController{})
+	for _, p := range []*Product{{Name: "Chair", Price: 49.9}, {Name: "Desk", Price: 150}, {Name: "Chalk, white", Price: 1.5}} {
+		products.Save(p)
+	}
+}
+
+func TestCSVExport(t *testing.T) {
+	for _, test := range []struct {
+		url    string
+		header []string
+	}{
+		{"/products?name=cha&_format=csv&_perPage=1&_sortField=Id", nil},
+		{"/products?name=cha&_perPage=1&_sortField=Id", []string{"Accept", CSVContentType}},
+	} {
+		w := request("GET", test.url, "", test.header...)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", test.url, w.Code, w.Body.String())
+		}
+		if disposition := w.Header().Get("Content-Disposition"); disposition != `attachment; filename="product.csv"` {
+			t.Errorf("%s: expected an attachment, got %q", test.url, disposition)
+		}
+		rows, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The pagination is ignored, and the header has the field names
+		expected := [][]string{{"Id", "Name", "Price"}, {"1", "Chair", "49.9"}, {"3", "Chalk, white", "1.5"}}
+		if len(rows) != len(expected) {
+			t.Fatalf("%s: expected %v, got %v", test.url, expected, rows)
+		}
+		for i := range expected {
+			if strings.Join(rows[i], "|") != strings.Join(expected[i], "|") {
+				t.Errorf("%s: expected row %v, got %v", test.url, expected[i], rows[i])
+			}
+		}
+	}
+}
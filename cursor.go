@@ -0,0 +1,119 @@
+package ngago
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/astaxie/beego/orm"
+)
+
+// ErrInvalidCursor is returned by ValidateOptions when the After cursor can't be decoded, or is used
+// with a sort that keyset pagination doesn't support
+var ErrInvalidCursor = errors.New("ngago: invalid cursor")
+
+/*
+CursorPaginator is implemented by repositories that support keyset pagination, as BaseRepository does.
+Cursor returns the cursor of an entity, that used as the After option selects the entities that follow
+it in the sort of the options
+*/
+type CursorPaginator interface {
+	Cursor(entity interface{}, options QueryOptions) (string, error)
+}
+
+/*
+Cursor encodes the values of the sort field and the id of the entity, as an opaque string. Keyset
+pagination requires the sort to be a single field of the entity, not nullable, or no sort, in which
+case the entities are sorted by id. Ties on the sort field are broken by the id
+*/
+func (r *BaseRepository) Cursor(entity interface{}, options QueryOptions) (string, error) {
+	f, _, ok := r.keysetField(options)
+	if !ok {
+		return "", ErrInvalidCursor
+	}
+	v := reflect.Indirect(reflect.ValueOf(entity))
+	b, err := json.Marshal([]interface{}{v.FieldByIndex(f.Index).Interface(), r.idOf(entity)})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// keysetField returns the field the options sort by, and if the sort is descending, when it can be used
+// for keyset pagination
+func (r *BaseRepository) keysetField(options QueryOptions) (entityField, bool, bool) {
+	var sort []string
+	for _, s := range strings.Split(options.Sort, ",") {
+		if s = strings.TrimSpace(nullsDirective.ReplaceAllString(s, "")); s != "" {
+			sort = append(sort, s)
+		}
+	}
+	if len(sort) > 1 {
+		return entityField{}, false, false
+	}
+	desc := strings.ToLower(options.Order) == "desc"
+	if len(sort) == 0 {
+		return r.idField, desc, true
+	}
+	if strings.HasPrefix(sort[0], "-") {
+		desc = !desc
+	}
+	f, ok := findField(r.instanceType, strings.TrimPrefix(sort[0], "-"))
+	if !ok || isRelation(f) || isToMany(r.instanceType, f.Name) || !r.isSortAllowed(f.Name) {
+		return entityField{}, false, false
+	}
+	return f, desc, true
+}
+
+// afterCondition builds the condition selecting the entities that follow the After cursor of the options
+func (r *BaseRepository) afterCondition(options QueryOptions) (*orm.Condition, error) {
+	f, desc, ok := r.keysetField(options)
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	b, err := base64.RawURLEncoding.DecodeString(options.After)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var values []json.RawMessage
+	if err := json.Unmarshal(b, &values); err != nil || len(values) != 2 {
+		return nil, ErrInvalidCursor
+	}
+	value, id := reflect.New(f.Type), reflect.New(r.idField.Type)
+	if json.Unmarshal(values[0], value.Interface()) != nil || json.Unmarshal(values[1], id.Interface()) != nil {
+		return nil, ErrInvalidCursor
+	}
+	op := "__gt"
+	if desc {
+		op = "__lt"
+	}
+	if f.Name == r.idField.Name {
+		return orm.NewCondition().And(r.idField.Name+op, id.Elem().Interface()), nil
+	}
+	tie := orm.NewCondition().And(f.Name, value.Elem().Interface()).And(r.idField.Name+op, id.Elem().Interface())
+	return orm.NewCondition().Or(f.Name+op, value.Elem().Interface()).OrCond(tie), nil
+}
+
+/*
+nextCursor returns the cursor of the last entity of a full page, to be sent back by the client in the
+_cursor param to read the next page with keyset pagination, or "" when there is no next page or the
+repository doesn't support it
+*/
+func (c *BaseRESTController) nextCursor(entities interface{}, options QueryOptions) string {
+	paginator, ok := c.repo.(CursorPaginator)
+	items := reflect.Indirect(reflect.ValueOf(entities))
+	if !ok || options.Max <= 0 || items.Kind() != reflect.Slice || items.Len() < options.Max {
+		return ""
+	}
+	last := items.Index(items.Len() - 1)
+	if last.Kind() != reflect.Ptr {
+		last = last.Addr()
+	}
+	cursor, err := paginator.Cursor(last.Interface(), options)
+	if err != nil {
+		return ""
+	}
+	return cursor
+}
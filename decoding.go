@@ -0,0 +1,201 @@
+package ngago
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+/*
+decodeEntity unmarshals a JSON body into entity. When an embedded struct of the entity implements
+json.Unmarshaler, its UnmarshalJSON method is promoted to the entity and encoding/json calls it for
+the whole body, silently ignoring the entity's own fields. In this case, the entity's own fields present
+in the body are then decoded individually, also when decoding into an entity already read, as Patch does
+*/
+func decodeEntity(body []byte, entity interface{}) error {
+	if err := json.Unmarshal(body, entity); err != nil {
+		return err
+	}
+	v := reflect.Indirect(reflect.ValueOf(entity))
+	if v.Kind() != reflect.Struct || !hasEmbeddedUnmarshaler(v.Type()) {
+		return nil
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil
+	}
+	return decodeFields(v, raw)
+}
+
+// decode unmarshals a request body into entity, translating the keys exposed by the FieldMapController
+// back to the entity's own
+func (c *BaseRESTController) decode(body []byte, entity interface{}) error {
+	ctrl, ok := c.AppController.(FieldMapController)
+	if !ok || len(ctrl.FieldMap()) == 0 {
+		return decodeEntity(body, entity)
+	}
+	names := make(map[string]string)
+	for k, name := range ctrl.FieldMap() {
+		names[name] = k
+	}
+	if obj, ok := decodeObject(json.RawMessage(body)); ok {
+		renamed, err := json.Marshal(renameKeys(obj, names))
+		if err != nil {
+			return err
+		}
+		body = renamed
+	}
+	return decodeEntity(body, entity)
+}
+
+/*
+decodeError builds the response for a request body that couldn't be decoded: a 400 for malformed JSON,
+and a 422 for well-formed JSON that doesn't fit the entity, naming the offending field when possible, ex:
+{"error": "...", "code": 422, "fields": {"age": "must be a number"}}. Fields are named as exposed by the
+FieldMapController
+*/
+func (c *BaseRESTController) decodeError(err error) ErrorResponse {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		return ErrorResponse{
+			Error: fmt.Sprintf("Malformed JSON body for %s at offset %d: %v", c.EntityName(), e.Offset, e),
+			Code:  http.StatusBadRequest,
+		}
+	case *json.UnmarshalTypeError:
+		if e.Field == "" {
+			break
+		}
+		field := e.Field
+		if ctrl, ok := c.AppController.(FieldMapController); ok {
+			path := strings.SplitN(field, ".", 2)
+			if name, ok := ctrl.FieldMap()[path[0]]; ok {
+				path[0] = name
+				field = strings.Join(path, ".")
+			}
+		}
+		msg := "must be " + jsonKind(e.Type)
+		return ErrorResponse{
+			Error:  fmt.Sprintf("Invalid value for field %s of %s: %s, not %s", field, c.EntityName(), msg, e.Value),
+			Code:   http.StatusUnprocessableEntity,
+			Fields: map[string]string{field: msg},
+		}
+	}
+	return ErrorResponse{Error: err.Error(), Code: http.StatusUnprocessableEntity}
+}
+
+// sendDecodeError logs and responds to a request body that couldn't be decoded, as built by decodeError
+func (c *BaseRESTController) sendDecodeError(body []byte, err error) {
+	c.log().Error(fmt.Sprintf("Error parsing %s %#v: %v", c.EntityName(), string(body), err))
+	c.sendErrorResponse(c.decodeError(err))
+}
+
+// jsonKind describes the JSON value expected for a Go type, ex: "a number" for an int
+func jsonKind(t reflect.Type) string {
+	t = indirectType(t)
+	if t == reflect.TypeOf(time.Time{}) {
+		return "a string"
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	}
+	return "a " + t.String()
+}
+
+// bodyKeys returns the keys present in a JSON object request body, translated back to the entity's own
+// keys when exposed differently by the FieldMapController
+func (c *BaseRESTController) bodyKeys(body []byte) []string {
+	obj, ok := decodeObject(json.RawMessage(body))
+	if !ok {
+		return nil
+	}
+	names := make(map[string]string)
+	if ctrl, ok := c.AppController.(FieldMapController); ok {
+		for k, name := range ctrl.FieldMap() {
+			names[name] = k
+		}
+	}
+	keys := make([]string, len(obj.Keys()))
+	for i, k := range obj.Keys() {
+		if name, ok := names[k]; ok {
+			k = name
+		}
+		keys[i] = k
+	}
+	return keys
+}
+
+func implementsUnmarshaler(t reflect.Type) bool {
+	return t.Implements(jsonUnmarshalerType) || reflect.PtrTo(t).Implements(jsonUnmarshalerType)
+}
+
+func hasEmbeddedUnmarshaler(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if sf := t.Field(i); sf.Anonymous && implementsUnmarshaler(sf.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeFields(v reflect.Value, raw map[string]json.RawMessage) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if sf.Anonymous && name == "" {
+			if fv.Kind() == reflect.Struct && !implementsUnmarshaler(sf.Type) {
+				if err := decodeFields(fv, raw); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if sf.PkgPath != "" || !fv.CanSet() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		value, ok := raw[name]
+		if !ok {
+			for k, val := range raw {
+				if strings.EqualFold(k, name) {
+					value, ok = val, true
+					break
+				}
+			}
+		}
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(value, fv.Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isZero(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
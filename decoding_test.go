@@ -0,0 +1,103 @@
+package ngago
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/astaxie/beego"
+)
+
+// Base is embedded by the entities, with its own UnmarshalJSON, promoted to them
+type Base struct {
+	Id        int64
+	CreatedBy string
+}
+
+func (b *Base) UnmarshalJSON(data []byte) error {
+	type plain Base
+	p := plain(*b)
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	p.CreatedBy = strings.ToLower(p.CreatedBy)
+	*b = Base(p)
+	return nil
+}
+
+type Color string
+
+func (c *Color) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*c = Color(strings.ToUpper(s))
+	return nil
+}
+
+type Tag struct {
+	Base
+	Name  string
+	Color Color
+}
+
+var tags = NewMemoryRepository("tag", Tag{})
+
+type TagController struct {
+	BaseRESTController
+}
+
+func (c *TagController) NewRepo() Repository {
+	return tags
+}
+
+func (c *TagController) Id(entity interface{}) int64 {
+	return entity.(*Tag).Id
+}
+
+func init() {
+	beego.Router("/tags", &TagController{})
+	beego.Router("/tags/:id", &TagController{})
+}
+
+func TestDecodeEntityWithEmbeddedUnmarshaler(t *testing.T) {
+	tag := &Tag{}
+	if err := decodeEntity([]byte(`{"Id":3,"CreatedBy":"ANN","Name":"go","Color":"red"}`), tag); err != nil {
+		t.Fatal(err)
+	}
+	expected := Tag{Base: Base{Id: 3, CreatedBy: "ann"}, Name: "go", Color: "RED"}
+	if *tag != expected {
+		t.Errorf("expected %+v, got %+v", expected, *tag)
+	}
+}
+
+func TestDecodeEntityKeepsTheFieldsMissingFromTheBody(t *testing.T) {
+	tag := &Tag{Base: Base{Id: 3, CreatedBy: "ann"}, Name: "go", Color: "RED"}
+	if err := decodeEntity([]byte(`{"Name":"rust"}`), tag); err != nil {
+		t.Fatal(err)
+	}
+	expected := Tag{Base: Base{Id: 3, CreatedBy: "ann"}, Name: "rust", Color: "RED"}
+	if *tag != expected {
+		t.Errorf("expected %+v, got %+v", expected, *tag)
+	}
+}
+
+func TestEmbeddedFieldsRoundTrip(t *testing.T) {
+	w := request("POST", "/tags", `{"CreatedBy":"ANN","Name":"go","Color":"red"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	w = request("GET", w.Header().Get("Location"), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["CreatedBy"] != "ann" || body["Name"] != "go" || body["Color"] != "RED" {
+		t.Errorf("expected all the fields to be kept, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,109 @@
+package ngago
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Controllers can implement this interface to compute their own ETags for the entities returned by Get,
+ex: from a hash kept in a column. ETag returns the whole header value, quotes included, ex: `"v5"`, or
+"" to send no ETag. When not implemented, the ETag is computed from the repository's Versioner or else
+from a hash of the response body
+*/
+type ETagController interface {
+	ETag(entity interface{}) string
+}
+
+// Versioner is implemented by repositories that keep a version of their entities, as BaseRepository does
+// when configured with VersionField. Version returns false for entities without one
+type Versioner interface {
+	Version(entity interface{}) (string, bool)
+}
+
+/*
+VersionField declares the field that changes whenever an entity is updated, ex: a "Version" counter or
+an "UpdatedAt" timestamp. It's used to compute the ETags of the entities, instead of hashing the whole
+response body
+*/
+func (r *BaseRepository) VersionField(field string) {
+	f, ok := findField(r.instanceType, field)
+	if !ok {
+		panic(fmt.Sprintf("ngago: invalid version field %s for %s", field, r.table))
+	}
+	r.versionField = f.Name
+}
+
+// Version returns the value of the field declared with VersionField, formatted as a string
+func (r *BaseRepository) Version(entity interface{}) (string, bool) {
+	if r.versionField == "" {
+		return "", false
+	}
+	fv := reflect.Indirect(reflect.ValueOf(entity)).FieldByName(r.versionField)
+	if !fv.IsValid() {
+		return "", false
+	}
+	if t, ok := fv.Interface().(time.Time); ok {
+		return strconv.FormatInt(t.UnixNano(), 10), true
+	}
+	return fmt.Sprint(fv.Interface()), true
+}
+
+/*
+notModified sets the ETag header for the entity, and responds with a 304 (Not Modified) with no body
+when it matches the If-None-Match header of the request. data is the representation of the entity sent
+to the client, hashed when there is no other source for the ETag
+*/
+func (c *BaseRESTController) notModified(entity, data interface{}) bool {
+	etag := c.entityETag(entity, data)
+	if etag == "" {
+		return false
+	}
+	c.Ctx.Output.Header("ETag", etag)
+	if !etagMatches(c.Ctx.Input.Header("If-None-Match"), etag) {
+		return false
+	}
+	c.Ctx.Output.SetStatus(http.StatusNotModified)
+	c.Ctx.Output.Body([]byte{})
+	return true
+}
+
+func (c *BaseRESTController) entityETag(entity, data interface{}) string {
+	if ctrl, ok := c.AppController.(ETagController); ok {
+		return ctrl.ETag(entity)
+	}
+	if versioner, ok := c.repo.(Versioner); ok {
+		if version, ok := versioner.Version(entity); ok {
+			return `W/"` + hashHex([]byte(fmt.Sprintf("%v:%s", c.entityId(entity), version))) + `"`
+		}
+	}
+	body, err := json.Marshal(represent(data))
+	if err != nil {
+		return ""
+	}
+	return `"` + hashHex(body) + `"`
+}
+
+// etagMatches compares an ETag with the ones listed in an If-None-Match header, with the weak
+// comparison: W/"x" matches "x"
+func etagMatches(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func hashHex(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
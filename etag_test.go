@@ -0,0 +1,89 @@
+package ngago
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/astaxie/beego"
+)
+
+type TaggedBookController struct {
+	BookController
+}
+
+// ETag tags the books with their number of pages, sending no ETag for the book 2
+func (c *TaggedBookController) ETag(entity interface{}) string {
+	if book := entity.(*Book); book.Id != 2 {
+		return fmt.Sprintf(`"p%d"`, book.Pages)
+	}
+	return ""
+}
+
+func init() {
+	beego.Router("/tagged/books/:id", &TaggedBookController{})
+}
+
+func TestETagsAreHashesOfTheBody(t *testing.T) {
+	resetBooks(t)
+	w := request("GET", "/books/1", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || !strings.HasPrefix(etag, `"`) {
+		t.Fatalf("expected 200 with a strong ETag, got %d, %q", w.Code, etag)
+	}
+	for _, header := range []string{etag, `"other", ` + etag, "W/" + etag, "*"} {
+		for _, method := range []string{"GET", "HEAD"} {
+			w := request(method, "/books/1", "", "If-None-Match", header)
+			if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+				t.Errorf("%s %s: expected 304 with no body, got %d: %s", method, header, w.Code, w.Body.String())
+			}
+		}
+	}
+	if w := request("GET", "/books/3", "", "If-None-Match", etag); w.Code != http.StatusOK {
+		t.Errorf("expected 200 for another book, got %d", w.Code)
+	}
+	if w := request("PATCH", "/books/1", `{"Pages":320}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	w = request("GET", "/books/1", "", "If-None-Match", etag)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("expected 200 with a new ETag after an update, got %d, %q", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestETagsOfVersionedEntitiesAreWeak(t *testing.T) {
+	resetArticles(t)
+	w := request("GET", "/articles/1", "")
+	etag := w.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("expected a weak ETag, got %q", etag)
+	}
+	if w := request("GET", "/articles/1", "", "If-None-Match", strings.TrimPrefix(etag, "W/")); w.Code != http.StatusNotModified {
+		t.Errorf("expected the weak comparison to match, got %d", w.Code)
+	}
+	article := &Article{}
+	r := newArticleRepository()
+	r.Read(int64(1), article)
+	article.Title = "Published"
+	if err := r.Update(article); err != nil {
+		t.Fatal(err)
+	}
+	if w := request("GET", "/articles/1", "", "If-None-Match", etag); w.Code != http.StatusOK {
+		t.Errorf("expected 200 after a new version, got %d", w.Code)
+	}
+}
+
+func TestETagControllersComputeTheirOwnETags(t *testing.T) {
+	resetBooks(t)
+	if w := request("GET", "/tagged/books/3", ""); w.Header().Get("ETag") != `"p412"` {
+		t.Errorf(`expected the ETag "p412", got %q`, w.Header().Get("ETag"))
+	}
+	if w := request("GET", "/tagged/books/3", "", "If-None-Match", `"p412"`); w.Code != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", w.Code)
+	}
+	w := request("GET", "/tagged/books/2", "", "If-None-Match", "*")
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != "" {
+		t.Errorf("expected 200 with no ETag, got %d, %q", w.Code, w.Header().Get("ETag"))
+	}
+}
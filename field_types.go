@@ -0,0 +1,180 @@
+package ngago
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldType declares how filter values for a field are coerced before querying. See AddTypedFilter
+type FieldType int
+
+const (
+	FieldString FieldType = iota
+	FieldInt
+	FieldFloat
+	FieldBool
+	FieldDate
+	FieldEnum
+)
+
+var dateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+func (t FieldType) String() string {
+	switch t {
+	case FieldInt:
+		return "int"
+	case FieldFloat:
+		return "float"
+	case FieldBool:
+		return "bool"
+	case FieldDate:
+		return "date"
+	case FieldEnum:
+		return "enum"
+	}
+	return "string"
+}
+
+// Parse converts a filter value, as received from the query string or the _filters JSON, to the field type
+func (t FieldType) Parse(value interface{}) (interface{}, error) {
+	if n, ok := value.(json.Number); ok {
+		if i, err := n.Int64(); err == nil && t == FieldInt {
+			return i, nil
+		}
+		if t == FieldString || t == FieldEnum {
+			return n.String(), nil
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value: %v", t, value)
+		}
+		value = f
+	}
+	switch t {
+	case FieldInt:
+		switch v := value.(type) {
+		case float64:
+			if v == math.Trunc(v) {
+				return int64(v), nil
+			}
+		case string:
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return i, nil
+			}
+			if f, err := strconv.ParseFloat(v, 64); err == nil && f == math.Trunc(f) {
+				return int64(f), nil
+			}
+		}
+	case FieldFloat:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f, nil
+			}
+		}
+	case FieldBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case float64:
+			if v == 0 || v == 1 {
+				return v == 1, nil
+			}
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+	case FieldDate:
+		if v, ok := value.(string); ok {
+			for _, layout := range dateLayouts {
+				if d, err := time.Parse(layout, v); err == nil {
+					return d, nil
+				}
+			}
+		}
+	default:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+	}
+	return nil, fmt.Errorf("invalid %s value: %v", t, value)
+}
+
+// inferFieldType returns the FieldType for comparing values with a numeric or date field, ex: in range
+// filters, so "10" is compared as a number and "2016-01-01" as a date
+func inferFieldType(t reflect.Type) (FieldType, bool) {
+	t = indirectType(t)
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return FieldInt, true
+	case reflect.Float32, reflect.Float64:
+		return FieldFloat, true
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return FieldDate, true
+	}
+	return FieldString, false
+}
+
+// filterString converts a plain filter value to the string passed to the FilterFuncs, returning false for
+// values that can't be one, like null, lists and objects
+func filterString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+func isBool(value interface{}) bool {
+	_, ok := value.(bool)
+	return ok
+}
+
+func isString(value interface{}) bool {
+	_, ok := value.(string)
+	return ok
+}
+
+// joinFieldValues formats a list of filter values as a comma separated string
+func joinFieldValues(values []interface{}) string {
+	items := make([]string, len(values))
+	for i, v := range values {
+		items[i] = formatFieldValue(v)
+	}
+	return strings.Join(items, ",")
+}
+
+func formatFieldValue(value interface{}) string {
+	switch v := value.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
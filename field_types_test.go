@@ -0,0 +1,87 @@
+package ngago
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseBool(t *testing.T) {
+	for _, value := range []interface{}{true, "true", "1", 1.0, json.Number("1")} {
+		if b, err := FieldBool.Parse(value); err != nil || b != true {
+			t.Errorf("%#v: expected true, got %v, %v", value, b, err)
+		}
+	}
+	for _, value := range []interface{}{false, "false", "0", 0.0} {
+		if b, err := FieldBool.Parse(value); err != nil || b != false {
+			t.Errorf("%#v: expected false, got %v, %v", value, b, err)
+		}
+	}
+	for _, value := range []interface{}{"yes please", 2.0, nil} {
+		if _, err := FieldBool.Parse(value); err == nil {
+			t.Errorf("%#v: expected an error", value)
+		}
+	}
+}
+
+func TestParseInt(t *testing.T) {
+	for _, value := range []interface{}{5.0, "5", "5.0", json.Number("5")} {
+		if i, err := FieldInt.Parse(value); err != nil || i != int64(5) {
+			t.Errorf("%#v: expected 5, got %v, %v", value, i, err)
+		}
+	}
+	for _, value := range []interface{}{5.5, "five", true} {
+		if _, err := FieldInt.Parse(value); err == nil {
+			t.Errorf("%#v: expected an error", value)
+		}
+	}
+}
+
+func TestParseEnum(t *testing.T) {
+	if v, err := FieldEnum.Parse(json.Number("3")); err != nil || v != "3" {
+		t.Errorf("expected \"3\", got %v, %v", v, err)
+	}
+	if _, err := FieldEnum.Parse(nil); err == nil {
+		t.Error("expected an error for null")
+	}
+}
+
+func TestTypedFilters(t *testing.T) {
+	resetBooks(t)
+	tests := []struct {
+		filters map[string]interface{}
+		count   int
+	}{
+		{map[string]interface{}{"available": "true"}, 2},
+		{map[string]interface{}{"available": 0.0}, 1},
+		{map[string]interface{}{"pages": "310"}, 1},
+		{map[string]interface{}{"pages": json.Number("412")}, 1},
+		{map[string]interface{}{"pages": []interface{}{"310", 412.0}}, 2},
+		{map[string]interface{}{"pages": "many"}, 3},
+		{map[string]interface{}{"title": "dune"}, 1},
+		{map[string]interface{}{"title": []interface{}{"DUNE", "the hobbit"}}, 2},
+		{map[string]interface{}{"title": "The"}, 3},
+	}
+	for _, test := range tests {
+		r := NewRepository("book", Book{})
+		r.AddTypedFilter("available", FieldBool)
+		r.AddTypedFilter("pages", FieldInt)
+		r.AddEnumFilter("title", "Dune", "The Hobbit", "The Silmarillion")
+		count, err := r.Count(QueryOptions{Filters: test.filters})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != int64(test.count) {
+			t.Errorf("%v: expected %d books, got %d", test.filters, test.count, count)
+		}
+	}
+}
+
+func TestInvalidTypedFilterValuesAreWarned(t *testing.T) {
+	resetBooks(t)
+	r := NewRepository("book", Book{})
+	r.AddEnumFilter("title", "Dune")
+	r.Count(QueryOptions{Filters: map[string]interface{}{"title": "Emma"}})
+	if len(r.Warnings()) == 0 {
+		t.Error("expected a warning for the value not in the enum")
+	}
+}
@@ -0,0 +1,328 @@
+package ngago
+
+import (
+	"reflect"
+	"strings"
+)
+
+// entityField is an exported field of an entity struct, along with its orm column name
+type entityField struct {
+	reflect.StructField
+	Column string
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// entityFields lists the fields of a struct mapped by the orm, flattening anonymous structs as the orm does
+func entityFields(t reflect.Type) []entityField {
+	t = indirectType(t)
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []entityField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" || sf.Tag.Get("orm") == "-" {
+			continue
+		}
+		if sf.Anonymous && indirectType(sf.Type).Kind() == reflect.Struct {
+			for _, f := range entityFields(sf.Type) {
+				f.Index = append([]int{i}, f.Index...)
+				fields = append(fields, f)
+			}
+			continue
+		}
+		fields = append(fields, entityField{StructField: sf, Column: ormColumn(sf)})
+	}
+	return fields
+}
+
+func ormColumn(sf reflect.StructField) string {
+	for _, t := range strings.Split(sf.Tag.Get("orm"), ";") {
+		t = strings.TrimSpace(t)
+		if strings.HasPrefix(strings.ToLower(t), "column(") && strings.HasSuffix(t, ")") {
+			return t[len("column(") : len(t)-1]
+		}
+	}
+	if isRelation(entityField{StructField: sf}) {
+		return snakeString(sf.Name) + "_id"
+	}
+	return snakeString(sf.Name)
+}
+
+// jsonName returns the key used by encoding/json for the field, or "" if it's not serialized
+func jsonName(f entityField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// jsonColumns maps JSON keys of an entity to the orm columns of the fields they are decoded into
+func jsonColumns(t reflect.Type, keys []string) []string {
+	var columns []string
+	for _, f := range jsonFields(t, keys) {
+		columns = append(columns, f.Column)
+	}
+	return columns
+}
+
+/*
+jsonFields maps JSON keys of an entity to the fields they are decoded into, matching keys as encoding/json
+does: exactly first, then case-insensitively. Unknown keys and the primary key are skipped
+*/
+func jsonFields(t reflect.Type, keys []string) []entityField {
+	fields := entityFields(t)
+	pk := primaryKey(t)
+	var matches []entityField
+	for _, key := range keys {
+		var match *entityField
+		for i, f := range fields {
+			name := jsonName(f)
+			if name == key {
+				match = &fields[i]
+				break
+			}
+			if match == nil && strings.EqualFold(name, key) {
+				match = &fields[i]
+			}
+		}
+		if match != nil && match.Name != pk.Name {
+			matches = append(matches, *match)
+		}
+	}
+	return matches
+}
+
+// primaryKey returns the primary key field of an entity, as the orm determines it: the field tagged
+// with orm:"pk", or else the Id field
+func primaryKey(t reflect.Type) entityField {
+	fields := entityFields(t)
+	for _, f := range fields {
+		if hasOrmTag(f, "pk") {
+			return f
+		}
+	}
+	f, _ := findField(t, "Id")
+	return f
+}
+
+// isZeroId tells if an id is unset, ex: 0 or ""
+func isZeroId(id interface{}) bool {
+	return id == nil || isEmptyValue(reflect.ValueOf(id))
+}
+
+// findField looks up a field by name, case insensitively, or by column name, as the orm accepts both, or
+// else by the JSON key clients see, ex: "email_address" for a field tagged with json:"email_address"
+func findField(t reflect.Type, name string) (entityField, bool) {
+	fields := entityFields(t)
+	for _, f := range fields {
+		if strings.EqualFold(f.Name, name) || f.Column == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if name != "" && jsonName(f) == name {
+			return f, true
+		}
+	}
+	return entityField{}, false
+}
+
+/*
+translatePath replaces the names of the fields in a path separated by "__" with the field names known by
+the orm, as far as they are found with findField, ex: "author__email_address__istartswith" ->
+"Author__Email__istartswith", so clients can filter and sort by the JSON keys of the entities
+*/
+func translatePath(t reflect.Type, path string) string {
+	names := strings.Split(path, "__")
+	for i, name := range names {
+		f, ok := findField(t, name)
+		if !ok {
+			break
+		}
+		names[i] = f.Name
+		t = indirectType(f.Type)
+		if t.Kind() == reflect.Slice {
+			t = indirectType(t.Elem())
+		}
+	}
+	return strings.Join(names, "__")
+}
+
+// resolveField looks up a field path separated by "__", following relations, ex: "Author__Name"
+func resolveField(t reflect.Type, path string) (entityField, bool) {
+	var f entityField
+	for _, name := range strings.Split(path, "__") {
+		var ok bool
+		if f, ok = findField(t, name); !ok {
+			return f, false
+		}
+		t = indirectType(f.Type)
+		if t.Kind() == reflect.Slice {
+			t = indirectType(t.Elem())
+		}
+	}
+	return f, true
+}
+
+/*
+fieldNames resolves a field path separated by "__" as far as it references fields of the entity and its
+relations, returning their names, ex: "author__name__istartswith" -> ["Author", "Name"]. A trailing "Id"
+suffix references the id of a relation, ex: "authorId" -> ["Author", "Id"]
+*/
+func fieldNames(t reflect.Type, path string) []string {
+	var names []string
+	for _, name := range strings.Split(path, "__") {
+		f, ok := findField(t, name)
+		if !ok {
+			if len(name) > 2 && strings.HasSuffix(name, "Id") {
+				if f, ok = findField(t, strings.TrimSuffix(name, "Id")); ok {
+					names = append(names, f.Name, "Id")
+				}
+			}
+			break
+		}
+		names = append(names, f.Name)
+		t = indirectType(f.Type)
+		if t.Kind() == reflect.Slice {
+			t = indirectType(t.Elem())
+		}
+	}
+	return names
+}
+
+/*
+relationId resolves a field path referencing the id of a relation, with an "Id" or "__id" suffix, to the
+path of the primary key of the related entity, ex: "authorId" -> "author__Code" when Author's primary key
+is Code. It also returns the primary key field, to convert the filter values to its type
+*/
+func relationId(t reflect.Type, path string) (string, entityField, bool) {
+	var base string
+	switch {
+	case strings.HasSuffix(path, "__id"):
+		base = strings.TrimSuffix(path, "__id")
+	case len(path) > 2 && strings.HasSuffix(path, "Id"):
+		base = strings.TrimSuffix(path, "Id")
+	default:
+		return "", entityField{}, false
+	}
+	f, ok := resolveField(t, base)
+	if !ok || !isRelation(f) {
+		return "", entityField{}, false
+	}
+	pk := primaryKey(f.Type)
+	return base + "__" + pk.Name, pk, true
+}
+
+// isToMany tells if a field path separated by "__" goes through a many-to-many or reverse many relation,
+// that would duplicate the entities when joined
+func isToMany(t reflect.Type, path string) bool {
+	for _, name := range strings.Split(path, "__") {
+		f, ok := findField(t, name)
+		if !ok {
+			return false
+		}
+		if hasOrmTag(f, "rel(m2m)") || hasOrmTag(f, "reverse(many)") {
+			return true
+		}
+		t = indirectType(f.Type)
+		if t.Kind() == reflect.Slice {
+			t = indirectType(t.Elem())
+		}
+	}
+	return false
+}
+
+/*
+ormPath converts a field path separated by "__" to the path expected by the orm, that goes through the
+intermediate model of the many-to-many relations, ex: "Roles__Name" -> "Roles__Role__Name". Only the
+intermediate models generated by the orm are supported, not the ones declared with rel_through
+*/
+func ormPath(t reflect.Type, path string) string {
+	names := strings.Split(path, "__")
+	var result []string
+	for i, name := range names {
+		result = append(result, name)
+		f, ok := findField(t, name)
+		if !ok {
+			result = append(result, names[i+1:]...)
+			break
+		}
+		t = indirectType(f.Type)
+		if t.Kind() == reflect.Slice {
+			t = indirectType(t.Elem())
+		}
+		if hasOrmTag(f, "rel(m2m)") && i+1 < len(names) && !strings.EqualFold(names[i+1], t.Name()) {
+			result = append(result, t.Name())
+		}
+	}
+	return strings.Join(result, "__")
+}
+
+func hasOrmTag(f entityField, tag string) bool {
+	for _, t := range strings.Split(strings.ToLower(f.Tag.Get("orm")), ";") {
+		if strings.TrimSpace(t) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func isRelation(f entityField) bool {
+	return hasOrmTag(f, "rel(fk)") || hasOrmTag(f, "rel(one)")
+}
+
+/*
+fieldRelations lists the relations (in the format accepted by RelatedSel) referenced by the dotted
+field paths, ex: ["id", "author.name", "author.publisher.name"] -> ["Author", "Author__Publisher"].
+The returned slice is never nil, so no relations are loaded when none is referenced
+*/
+func fieldRelations(t reflect.Type, fields []string) []string {
+	related := []string{}
+	seen := make(map[string]bool)
+	for _, path := range fields {
+		rt := t
+		var names []string
+		for _, name := range strings.Split(strings.TrimSpace(path), ".") {
+			f, ok := findField(rt, name)
+			if !ok || !isRelation(f) {
+				break
+			}
+			names = append(names, f.Name)
+			rel := strings.Join(names, "__")
+			if !seen[rel] {
+				seen[rel] = true
+				related = append(related, rel)
+			}
+			rt = indirectType(f.Type)
+		}
+	}
+	return related
+}
+
+// snakeString converts a field name to its default column name, the same way the orm does
+func snakeString(s string) string {
+	data := make([]byte, 0, len(s)*2)
+	j := false
+	for i := 0; i < len(s); i++ {
+		d := s[i]
+		if i > 0 && d >= 'A' && d <= 'Z' && j {
+			data = append(data, '_')
+		}
+		if d != '_' {
+			j = true
+		}
+		data = append(data, d)
+	}
+	return strings.ToLower(string(data))
+}
@@ -0,0 +1,64 @@
+package ngago
+
+import "github.com/astaxie/beego/orm"
+
+// BeforeSaver is implemented by entities that need to run logic before being inserted by Save, ex:
+// setting a CreatedAt timestamp or generating a slug. Returning an error aborts the insert
+type BeforeSaver interface {
+	BeforeSave() error
+}
+
+// AfterSaver is implemented by entities that need to run logic after being inserted by Save. The error
+// returned is returned by Save, but the entity is already inserted
+type AfterSaver interface {
+	AfterSave() error
+}
+
+/*
+BeforeUpdater is implemented by entities that need to run logic before being updated by Update, ex:
+setting an UpdatedAt timestamp. Returning an error aborts the update. When Update is called with a
+list of columns, only those are written, so fields set by the hook must be among them, if listed
+*/
+type BeforeUpdater interface {
+	BeforeUpdate() error
+}
+
+// AfterUpdater is implemented by entities that need to run logic after being updated by Update. It's not
+// called when the entity is not found. The error returned is returned by Update
+type AfterUpdater interface {
+	AfterUpdate() error
+}
+
+// insert inserts the entity with o, running its BeforeSaver and AfterSaver hooks
+func insert(o orm.Ormer, entity interface{}) (int64, error) {
+	if hook, ok := entity.(BeforeSaver); ok {
+		if err := hook.BeforeSave(); err != nil {
+			return 0, err
+		}
+	}
+	id, err := o.Insert(entity)
+	if err != nil {
+		return id, err
+	}
+	if hook, ok := entity.(AfterSaver); ok {
+		err = hook.AfterSave()
+	}
+	return id, err
+}
+
+// update updates the entity with o, running its BeforeUpdater and AfterUpdater hooks
+func update(o orm.Ormer, entity interface{}, cols ...string) (int64, error) {
+	if hook, ok := entity.(BeforeUpdater); ok {
+		if err := hook.BeforeUpdate(); err != nil {
+			return 0, err
+		}
+	}
+	count, err := o.Update(entity, cols...)
+	if err != nil || count == 0 {
+		return count, err
+	}
+	if hook, ok := entity.(AfterUpdater); ok {
+		err = hook.AfterUpdate()
+	}
+	return count, err
+}
@@ -0,0 +1,152 @@
+package ngago
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/orm"
+)
+
+type Comment struct {
+	Id        int64
+	Text      string
+	CreatedAt time.Time `orm:"null"`
+	UpdatedAt time.Time `orm:"null"`
+}
+
+func (c *Comment) BeforeSave() error {
+	if c.Text == "" {
+		return errors.New("text is required")
+	}
+	c.CreatedAt = time.Now()
+	return nil
+}
+
+func (c *Comment) BeforeUpdate() error {
+	c.UpdatedAt = time.Now()
+	return nil
+}
+
+// Revision stands for the entities with columns set outside of the received entity, ex: by triggers
+type Revision struct {
+	Id        int64
+	Text      string
+	UpdatedAt time.Time `orm:"null"`
+}
+
+func (r *Revision) AfterUpdate() error {
+	_, err := orm.NewOrm().QueryTable("revision").Filter("Id", r.Id).Update(orm.Params{"UpdatedAt": time.Now()})
+	return err
+}
+
+type RevisionController struct {
+	BaseRESTController
+}
+
+func (c *RevisionController) NewRepo() Repository {
+	return NewRepository("revision", Revision{})
+}
+
+func (c *RevisionController) Id(entity interface{}) int64 {
+	return entity.(*Revision).Id
+}
+
+type FreshRevisionController struct {
+	RevisionController
+}
+
+func (c *FreshRevisionController) ReturnUpdated() bool {
+	return true
+}
+
+func init() {
+	orm.RegisterModel(new(Comment), new(Revision))
+	beego.Router("/revisions/:id", &RevisionController{})
+	beego.Router("/fresh/revisions/:id", &FreshRevisionController{})
+}
+
+func resetComments(t *testing.T) {
+	if _, err := orm.NewOrm().Raw("DELETE FROM comment").Exec(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBeforeSaveSetsTheCreationTime(t *testing.T) {
+	resetComments(t)
+	r := NewRepository("comment", Comment{})
+	id, err := r.Save(&Comment{Text: "First!"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := &Comment{}
+	if err := r.Read(id, stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.CreatedAt.IsZero() || time.Since(stored.CreatedAt) > time.Minute {
+		t.Errorf("expected the creation time to be set, got %v", stored.CreatedAt)
+	}
+	if !stored.UpdatedAt.IsZero() {
+		t.Errorf("expected no update time, got %v", stored.UpdatedAt)
+	}
+}
+
+func TestBeforeSaveErrorsAbortTheInsert(t *testing.T) {
+	resetComments(t)
+	if _, err := NewRepository("comment", Comment{}).Save(&Comment{}); err == nil {
+		t.Error("expected the error of the hook")
+	}
+	if count := countRows(t, "comment"); count != 0 {
+		t.Errorf("expected nothing to be inserted, got %d comments", count)
+	}
+}
+
+func TestBeforeUpdateSetsTheUpdateTime(t *testing.T) {
+	resetComments(t)
+	r := NewRepository("comment", Comment{})
+	comment := &Comment{Text: "First!"}
+	if _, err := r.Save(comment); err != nil {
+		t.Fatal(err)
+	}
+	comment.Text = "Second!"
+	if err := r.Update(comment); err != nil {
+		t.Fatal(err)
+	}
+	stored := &Comment{}
+	r.Read(comment.Id, stored)
+	if stored.UpdatedAt.IsZero() || stored.Text != "Second!" {
+		t.Errorf("expected the update time to be set, got %+v", stored)
+	}
+}
+
+func TestReturnUpdatedIncludesTheColumnsSetByHooks(t *testing.T) {
+	id, err := orm.NewOrm().Insert(&Revision{Text: "draft"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "/revisions/" + strconv.FormatInt(id, 10)
+	body := `{"Id":` + strconv.FormatInt(id, 10) + `,"Text":"final"}`
+	for _, test := range []struct {
+		url     string
+		updated bool
+	}{
+		{path, false},
+		{"/fresh" + path, true},
+	} {
+		w := request("PUT", test.url, body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", test.url, w.Code, w.Body.String())
+		}
+		revision := &Revision{}
+		if err := json.Unmarshal(w.Body.Bytes(), revision); err != nil {
+			t.Fatal(err)
+		}
+		if revision.Text != "final" || revision.UpdatedAt.IsZero() == test.updated {
+			t.Errorf("%s: expected the update time to be sent: %v, got %s", test.url, test.updated, w.Body.String())
+		}
+	}
+}
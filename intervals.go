@@ -0,0 +1,76 @@
+package ngago
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+IntervalSuffixes are recognized in filter keys as the RangeSuffixes are, to select the entities with a date
+or number field in an interval, bounds included: created_between=2024-01-01,2024-01-31 (a JSON array or
+repeated params are accepted too), created_after=2024-01-01 and created_before=2024-01-31. Either bound of
+_between can be left empty, ex: price_between=10, for no upper bound. Dates are parsed as the FieldDate
+filters are, and a date without a time as an upper bound includes the whole day, so the example selects
+all of January. Unparseable values are rejected by ValidateOptions, and so with a 400 by the controllers
+*/
+var IntervalSuffixes = []string{"_between", "_after", "_before"}
+
+// bound is one of the conditions of an interval filter: an orm comparison operator and its value
+type bound struct {
+	op    string
+	value interface{}
+}
+
+func isIntervalOperator(op string) bool {
+	return op == "between" || op == "after" || op == "before"
+}
+
+// intervalBounds converts the value of an interval filter with its operator to the bounds of the interval,
+// parsed as values of the field type
+func intervalBounds(t FieldType, op string, value interface{}) ([]bound, error) {
+	if t != FieldDate && t != FieldInt && t != FieldFloat {
+		return nil, errors.New("intervals are only supported by date and number fields")
+	}
+	var values []string
+	if items, ok := value.([]interface{}); ok {
+		for _, item := range items {
+			values = append(values, formatFieldValue(item))
+		}
+	} else if op == "between" {
+		values = strings.Split(formatFieldValue(value), ",")
+	} else {
+		values = []string{formatFieldValue(value)}
+	}
+	switch {
+	case op == "between" && len(values) != 2:
+		return nil, fmt.Errorf("two values, the lower and upper bounds, are expected: %v", value)
+	case op == "after":
+		values = append(values, "")
+	case op == "before":
+		values = append([]string{""}, values...)
+	}
+	if len(values) != 2 || strings.TrimSpace(values[0]) == "" && strings.TrimSpace(values[1]) == "" {
+		return nil, fmt.Errorf("a value is expected: %v", value)
+	}
+	var bounds []bound
+	for i, s := range values {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		v, err := t.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		b := bound{op: "gte", value: v}
+		if i == 1 {
+			b.op = "lte"
+			if _, err := time.Parse("2006-01-02", s); err == nil && t == FieldDate {
+				b = bound{op: "lt", value: v.(time.Time).AddDate(0, 0, 1)}
+			}
+		}
+		bounds = append(bounds, b)
+	}
+	return bounds, nil
+}
@@ -0,0 +1,73 @@
+package ngago
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/astaxie/beego"
+)
+
+/*
+Controllers can implement this interface to choose how their JSON responses, entities and errors alike,
+are formatted. Without it, responses are indented except in the PROD run mode, as with beego's ServeJSON,
+and null fields are included. Outside of PROD, clients can also choose the indentation of a response
+with the _pretty param, ex: _pretty=true, to debug with curl
+*/
+type JSONFormatController interface {
+	JSONFormat() JSONFormat
+}
+
+// JSONFormat is the formatting of the JSON responses. Field names are always the ones of the json
+// tags, and fields tagged with omitempty are left out when empty, as encoding/json does
+type JSONFormat struct {
+	Indent    bool // Indent the responses, with two spaces
+	OmitNulls bool // Leave out the null fields of objects, ex: nil pointers and invalid sql.NullString
+}
+
+// jsonFormat returns the formatting of the JSON responses, for the controller and the _pretty param
+func (c *BaseController) jsonFormat() JSONFormat {
+	format := JSONFormat{Indent: beego.BConfig.RunMode != beego.PROD}
+	if ctrl, ok := c.AppController.(JSONFormatController); ok {
+		format = ctrl.JSONFormat()
+	}
+	if beego.BConfig.RunMode != beego.PROD {
+		if pretty, err := strconv.ParseBool(c.Ctx.Input.Query("_pretty")); err == nil {
+			format.Indent = pretty
+		}
+	}
+	return format
+}
+
+// marshalJSON encodes data as JSON, with the controller's JSONFormat
+func (c *BaseController) marshalJSON(data interface{}) ([]byte, error) {
+	format := c.jsonFormat()
+	data = represent(data)
+	if format.OmitNulls {
+		data = omitNulls(data)
+	}
+	if format.Indent {
+		return json.MarshalIndent(data, "", "  ")
+	}
+	return json.Marshal(data)
+}
+
+// omitNulls removes the null fields of the objects of a representation, at any depth. Nulls in lists are kept
+func omitNulls(data interface{}) interface{} {
+	switch v := data.(type) {
+	case *object:
+		obj := newObject()
+		for _, k := range v.Keys() {
+			if value := v.values[k]; value != nil {
+				obj.Set(k, omitNulls(value))
+			}
+		}
+		return obj
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = omitNulls(item)
+		}
+		return list
+	}
+	return data
+}
@@ -0,0 +1,93 @@
+package ngago
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/astaxie/beego/orm"
+)
+
+// ErrConflict is returned by Update, for repositories configured with OptimisticLock, when the entity was
+// updated by someone else since it was read, so the update would overwrite their changes
+var ErrConflict = errors.New("ngago: entity was modified since it was read")
+
+/*
+OptimisticLock protects the entities against lost updates with a version counter, an integer field, ex:
+"Version". Update only succeeds when the entity still has the version being updated, that is then
+incremented, and returns ErrConflict otherwise: clients send the version they read, and when it's
+rejected must read the entity again, with its new version, and retry. A Patch without the version only
+updates the entity as it's currently stored. Save creates entities with the version they have, usually 0.
+The field is also used as the VersionField, to compute the ETags, unless a VersionField was declared. The
+Upsert fallback updates, Increment and UpdateMany don't use nor increment the version
+*/
+func (r *BaseRepository) OptimisticLock(field string) {
+	f, ok := findField(r.instanceType, field)
+	if !ok {
+		panic(fmt.Sprintf("ngago: invalid lock field %s for %s", field, r.table))
+	}
+	switch f.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		panic(fmt.Sprintf("ngago: invalid lock field %s for %s: it must be an integer", field, r.table))
+	}
+	r.lockField = f
+	if r.versionField == "" {
+		r.versionField = f.Name
+	}
+}
+
+/*
+lockedUpdate updates an entity if its version is the one stored, in a transaction: the stored version is
+first incremented, filtered by the expected one, so concurrent updates of the same version can't both
+succeed, and then the entity is updated with the new version
+*/
+func (r *BaseRepository) lockedUpdate(p interface{}, cols ...string) error {
+	fv := reflect.Indirect(reflect.ValueOf(p)).FieldByIndex(r.lockField.Index)
+	expected := fv.Interface()
+	err := r.withTx(func(tx orm.Ormer) error {
+		qs := r.query(tx).Filter(r.idField.Name, r.idOf(p))
+		count, err := qs.Filter(r.lockField.Name, expected).Update(orm.Params{
+			r.lockField.Name: orm.ColValue(orm.ColAdd, 1),
+		})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			if qs.Exist() {
+				return ErrConflict
+			}
+			return ErrNotFound
+		}
+		incrementInt(fv)
+		if len(cols) > 0 && !hasColumn(cols, r.lockField) {
+			cols = append(cols[:len(cols):len(cols)], r.lockField.Column)
+		}
+		_, err = update(tx, p, cols...)
+		return err
+	})
+	if err != nil {
+		fv.Set(reflect.ValueOf(expected))
+	}
+	return err
+}
+
+func incrementInt(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(v.Uint() + 1)
+	default:
+		v.SetInt(v.Int() + 1)
+	}
+}
+
+// hasColumn tells if the field is listed in the columns of an update, either by column or field name
+func hasColumn(cols []string, f entityField) bool {
+	for _, col := range cols {
+		if col == f.Column || col == f.Name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package ngago
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/orm"
+)
+
+type Article struct {
+	Id      int64
+	Title   string
+	Version int
+}
+
+func newArticleRepository(ormer ...orm.Ormer) *BaseRepository {
+	r := NewRepository("article", Article{}, ormer...)
+	r.OptimisticLock("Version")
+	return r
+}
+
+type ArticleController struct {
+	BaseRESTController
+}
+
+func (c *ArticleController) NewRepo() Repository {
+	return newArticleRepository()
+}
+
+func (c *ArticleController) Id(entity interface{}) int64 {
+	return entity.(*Article).Id
+}
+
+func init() {
+	orm.RegisterModel(new(Article))
+	beego.Router("/articles/:id", &ArticleController{})
+}
+
+func resetArticles(t *testing.T) {
+	o := orm.NewOrm()
+	o.Raw("DELETE FROM article").Exec()
+	if _, err := o.Insert(&Article{Id: 1, Title: "Draft", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOptimisticLockRejectsStaleUpdates(t *testing.T) {
+	resetArticles(t)
+	r := newArticleRepository()
+	first, second := &Article{}, &Article{}
+	r.Read(int64(1), first)
+	r.Read(int64(1), second)
+
+	first.Title = "First"
+	if err := r.Update(first); err != nil {
+		t.Fatal(err)
+	}
+	if first.Version != 2 {
+		t.Errorf("expected the version to be incremented to 2, got %d", first.Version)
+	}
+	second.Title = "Second"
+	if err := r.Update(second); err != ErrConflict {
+		t.Fatalf("expected ErrConflict for the stale update, got %v", err)
+	}
+	if second.Version != 1 {
+		t.Errorf("expected the version of the rejected entity to be kept, got %d", second.Version)
+	}
+	stored := &Article{}
+	r.Read(int64(1), stored)
+	if stored.Title != "First" || stored.Version != 2 {
+		t.Errorf("expected the first update to be kept, got %+v", stored)
+	}
+}
+
+func TestOptimisticLockReturnsNotFoundForMissingEntities(t *testing.T) {
+	resetArticles(t)
+	if err := newArticleRepository().Update(&Article{Id: 9, Version: 1}); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestOptimisticLockUpdatesAreRolledBackWithTheTransaction(t *testing.T) {
+	resetArticles(t)
+	errAbort := errors.New("abort")
+	err := WithTx(func(tx orm.Ormer) error {
+		if err := newArticleRepository(tx).Update(&Article{Id: 1, Title: "Changed", Version: 1}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatalf("expected the error of fn, got %v", err)
+	}
+	stored := &Article{}
+	newArticleRepository().Read(int64(1), stored)
+	if stored.Title != "Draft" || stored.Version != 1 {
+		t.Errorf("expected the update to be rolled back, got %+v", stored)
+	}
+}
+
+func TestPutOfStaleVersionRespondsConflict(t *testing.T) {
+	resetArticles(t)
+	w := request("PUT", "/articles/1", `{"Id":1,"Title":"First","Version":1}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	w = request("PUT", "/articles/1", `{"Id":1,"Title":"Second","Version":1}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for the stale version, got %d: %s", w.Code, w.Body.String())
+	}
+}
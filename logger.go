@@ -0,0 +1,54 @@
+package ngago
+
+import "github.com/astaxie/beego"
+
+// Logger receives the messages logged by the controllers and repositories, ex: an adapter for zap or logrus
+type Logger interface {
+	Error(v ...interface{})
+	Warn(v ...interface{})
+	Info(v ...interface{})
+}
+
+// DefaultLogger is used by the controllers that don't implement LoggerController and the repositories
+// without a logger set with SetLogger. It logs with beego's logger
+var DefaultLogger Logger = beegoLogger{}
+
+type beegoLogger struct{}
+
+func (beegoLogger) Error(v ...interface{}) { beego.Error(v...) }
+func (beegoLogger) Warn(v ...interface{})  { beego.Warn(v...) }
+func (beegoLogger) Info(v ...interface{})  { beego.Info(v...) }
+
+/*
+Controllers can implement this interface to log their messages with a specific Logger, instead of
+DefaultLogger. It's also set to repositories implementing LoggerSetter, as BaseRepository does
+*/
+type LoggerController interface {
+	Logger() Logger
+}
+
+// LoggerSetter is implemented by repositories that can log with a given Logger, as BaseRepository does
+type LoggerSetter interface {
+	SetLogger(logger Logger)
+}
+
+// SetLogger changes the Logger of the repository, DefaultLogger by default
+func (r *BaseRepository) SetLogger(logger Logger) {
+	r.logger = logger
+}
+
+func (r *BaseRepository) log() Logger {
+	if r.logger == nil {
+		return DefaultLogger
+	}
+	return r.logger
+}
+
+func (c *BaseController) log() Logger {
+	if ctrl, ok := c.AppController.(LoggerController); ok {
+		if logger := ctrl.Logger(); logger != nil {
+			return logger
+		}
+	}
+	return DefaultLogger
+}
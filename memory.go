@@ -0,0 +1,527 @@
+package ngago
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/orm"
+)
+
+// ErrNoQuerySeter is returned by the MemoryRepository methods that only make sense for orm queries
+var ErrNoQuerySeter = errors.New("ngago: orm queries are not supported by MemoryRepository")
+
+/*
+MemoryRepository is a Repository that keeps the entities in memory, to test controllers without a
+database. It honors the plain filters (strings by prefix, case insensitively, and other values exactly),
+lists of values, the RangeSuffixes, IntervalSuffixes and NullSuffix operators, the orm operators appended
+with "__", ex: "name__icontains", "authorId" filters and OrFilter groups, along with the sort and
+pagination of the options. Search, Fields, cursors and deleted scopes are ignored. Entities are read and
+saved as copies.
+
+As BaseRESTController calls NewRepo for every request, the same MemoryRepository must be returned by it,
+ex:
+
+	var users = ngago.NewMemoryRepository("user", User{})
+
+	func (c *UserController) NewRepo() ngago.Repository { return users }
+*/
+type MemoryRepository struct {
+	name         string
+	instanceType reflect.Type
+	idField      entityField
+
+	mu       sync.Mutex
+	entities map[string]reflect.Value
+	ids      []string
+	lastId   int64
+}
+
+// NewMemoryRepository creates an empty MemoryRepository for entities of the type of instance, ex: User{}
+func NewMemoryRepository(name string, instance interface{}) *MemoryRepository {
+	t := indirectType(reflect.TypeOf(instance))
+	return &MemoryRepository{
+		name:         name,
+		instanceType: t,
+		idField:      primaryKey(t),
+		entities:     make(map[string]reflect.Value),
+	}
+}
+
+func (r *MemoryRepository) IdField() string {
+	return r.idField.Name
+}
+
+func (r *MemoryRepository) EntityName() string {
+	return r.name
+}
+
+func (r *MemoryRepository) NewInstance() interface{} {
+	return reflect.New(r.instanceType).Interface()
+}
+
+func (r *MemoryRepository) NewSlice() interface{} {
+	return reflect.New(reflect.SliceOf(r.instanceType)).Interface()
+}
+
+func (r *MemoryRepository) Read(id interface{}, data interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entities[fmt.Sprint(id)]
+	if !ok {
+		return ErrNotFound
+	}
+	reflect.ValueOf(data).Elem().Set(e)
+	return nil
+}
+
+func (r *MemoryRepository) ReadAll(dataSet interface{}, options ...QueryOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	matches := r.find(options)
+	if len(options) > 0 {
+		opt := options[0]
+		if opt.Offset > 0 {
+			matches = matches[minInt(opt.Offset, len(matches)):]
+		}
+		if opt.Max > 0 && len(matches) > opt.Max {
+			matches = matches[:opt.Max]
+		}
+	}
+	items := reflect.ValueOf(dataSet).Elem()
+	items.Set(reflect.MakeSlice(items.Type(), 0, len(matches)))
+	for _, e := range matches {
+		if items.Type().Elem().Kind() == reflect.Ptr {
+			p := reflect.New(r.instanceType)
+			p.Elem().Set(e)
+			items.Set(reflect.Append(items, p))
+		} else {
+			items.Set(reflect.Append(items, e))
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) Count(options ...QueryOptions) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return int64(len(r.find(options))), nil
+}
+
+// Save adds a copy of the entity, assigning it the next id when its integer id is not set
+func (r *MemoryRepository) Save(p interface{}) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v := reflect.Indirect(reflect.ValueOf(p))
+	idv := v.FieldByIndex(r.idField.Index)
+	if isEmptyValue(idv) {
+		switch idv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			idv.SetInt(r.lastId + 1)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			idv.SetUint(uint64(r.lastId + 1))
+		default:
+			return 0, fmt.Errorf("ngago: the %s id must be set to be saved", r.name)
+		}
+	}
+	key := fmt.Sprint(idv.Interface())
+	if _, ok := r.entities[key]; ok {
+		return 0, fmt.Errorf("ngago: duplicate %s id %s", r.name, key)
+	}
+	var id int64
+	switch idv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		id = idv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		id = int64(idv.Uint())
+	}
+	if id > r.lastId {
+		r.lastId = id
+	}
+	r.entities[key] = copyValue(v)
+	r.ids = append(r.ids, key)
+	return id, nil
+}
+
+// Update replaces the stored entity with a copy of p, or only the given columns of it, returning
+// ErrNotFound if there's no entity with its id
+func (r *MemoryRepository) Update(p interface{}, cols ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v := reflect.Indirect(reflect.ValueOf(p))
+	key := fmt.Sprint(v.FieldByIndex(r.idField.Index).Interface())
+	stored, ok := r.entities[key]
+	if !ok {
+		return ErrNotFound
+	}
+	if len(cols) == 0 {
+		r.entities[key] = copyValue(v)
+		return nil
+	}
+	updated := copyValue(stored)
+	for _, col := range cols {
+		f, ok := findField(r.instanceType, col)
+		if !ok {
+			return fmt.Errorf("ngago: unknown %s field %s", r.name, col)
+		}
+		updated.FieldByIndex(f.Index).Set(v.FieldByIndex(f.Index))
+	}
+	r.entities[key] = updated
+	return nil
+}
+
+// Delete removes the entity with the given id, returning ErrNotFound if there's none, as BaseRepository's
+func (r *MemoryRepository) Delete(id interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := fmt.Sprint(id)
+	if _, ok := r.entities[key]; !ok {
+		return ErrNotFound
+	}
+	delete(r.entities, key)
+	for i, k := range r.ids {
+		if k == key {
+			r.ids = append(r.ids[:i], r.ids[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Columns maps JSON keys of the entities to their field names, for the partial updates of Patch
+func (r *MemoryRepository) Columns(jsonKeys ...string) []string {
+	var names []string
+	for _, f := range jsonFields(r.instanceType, jsonKeys) {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func (r *MemoryRepository) One(qs orm.QuerySeter, data interface{}) error {
+	return ErrNoQuerySeter
+}
+
+func (r *MemoryRepository) All(qs orm.QuerySeter, dataSet interface{}) (int64, error) {
+	return 0, ErrNoQuerySeter
+}
+
+func (r *MemoryRepository) PrepareQuery(qs orm.QuerySeter) orm.QuerySeter {
+	return qs
+}
+
+// BuildFilterCondition returns nil, as the filters are matched in memory
+func (r *MemoryRepository) BuildFilterCondition(options QueryOptions) *orm.Condition {
+	return nil
+}
+
+// find returns the entities matching the filters of the options, sorted as requested, or else by id
+func (r *MemoryRepository) find(options []QueryOptions) []reflect.Value {
+	var opt QueryOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+	var matches []reflect.Value
+	for _, key := range r.ids {
+		if e := r.entities[key]; r.matches(e, opt.Filters) {
+			matches = append(matches, e)
+		}
+	}
+	var keys []string
+	var desc []bool
+	for _, s := range strings.Split(opt.Sort, ",") {
+		s = strings.TrimSpace(nullsDirective.ReplaceAllString(s, ""))
+		if s == "" {
+			continue
+		}
+		reverse := strings.HasPrefix(s, "-") != (strings.ToLower(opt.Order) == "desc")
+		keys = append(keys, strings.Replace(strings.TrimPrefix(s, "-"), ".", "__", -1))
+		desc = append(desc, reverse)
+	}
+	keys, desc = append(keys, r.idField.Name), append(desc, strings.ToLower(opt.Order) == "desc" && len(keys) == 0)
+	sort.SliceStable(matches, func(i, j int) bool {
+		for k, key := range keys {
+			a, okA := r.fieldValue(matches[i], key)
+			b, okB := r.fieldValue(matches[j], key)
+			if !okA || !okB {
+				continue
+			}
+			if c := compareField(a, b.Interface()); c != 0 {
+				return (c < 0) != desc[k]
+			}
+		}
+		return false
+	})
+	return matches
+}
+
+// matches tells if the entity matches all the filters
+func (r *MemoryRepository) matches(e reflect.Value, filters map[string]interface{}) bool {
+	for key, value := range filters {
+		if key == OrFilter {
+			branches, ok := orBranches(value)
+			if !ok {
+				continue
+			}
+			any := len(branches) == 0
+			for _, branch := range branches {
+				any = any || r.matches(e, branch)
+			}
+			if !any {
+				return false
+			}
+			continue
+		}
+		path, op := r.parseKey(key)
+		fv, ok := r.fieldValue(e, path)
+		if !ok {
+			continue
+		}
+		if !matchValue(fv, op, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseKey splits a filter key into a field path separated by "__" and an operator
+func (r *MemoryRepository) parseKey(key string) (string, string) {
+	path := strings.Replace(key, ".", "__", -1)
+	if _, ok := r.fieldValue(reflect.New(r.instanceType).Elem(), path); ok {
+		return path, ""
+	}
+	if field, op, ok := defaultOperator(key); ok {
+		return strings.Replace(field, ".", "__", -1), op
+	}
+	if i := strings.LastIndex(path, "__"); i > 0 {
+		for _, op := range SafeOperators {
+			if path[i+2:] == op {
+				return path[:i], op
+			}
+		}
+	}
+	return path, ""
+}
+
+// fieldValue returns the value of a field path separated by "__" of the entity e, following its relations,
+// whose values are their ids. An "Id" suffix references the id of a relation, ex: "authorId"
+func (r *MemoryRepository) fieldValue(e reflect.Value, path string) (reflect.Value, bool) {
+	if f, ok := resolveField(r.instanceType, path); !ok {
+		if base := strings.TrimSuffix(strings.TrimSuffix(path, "__id"), "Id"); base != path {
+			if f, ok := resolveField(r.instanceType, base); !ok || !isEntityRef(f) {
+				return reflect.Value{}, false
+			}
+			path = base
+		} else {
+			return reflect.Value{}, false
+		}
+	} else if isToMany(r.instanceType, path) || f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() != reflect.Uint8 {
+		return reflect.Value{}, false
+	}
+	t, v := r.instanceType, e
+	for _, name := range strings.Split(path, "__") {
+		f, _ := findField(t, name)
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Zero(f.Type), true
+			}
+			v = v.Elem()
+		}
+		v, t = v.FieldByIndex(f.Index), indirectType(f.Type)
+	}
+	if st := indirectType(v.Type()); st.Kind() == reflect.Struct && st != reflect.TypeOf(time.Time{}) {
+		pk := primaryKey(st)
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return reflect.Zero(reflect.PtrTo(pk.Type)), true
+		}
+		v = reflect.Indirect(v).FieldByIndex(pk.Index)
+	}
+	return v, true
+}
+
+// isEntityRef tells if a field references another entity, declared as an orm relation or not
+func isEntityRef(f entityField) bool {
+	t := indirectType(f.Type)
+	return isRelation(f) || (f.Type.Kind() == reflect.Ptr && t.Kind() == reflect.Struct && t != reflect.TypeOf(time.Time{}))
+}
+
+// matchValue tells if a field value matches a filter value with the operator: strings by prefix, case
+// insensitively, and other values exactly when there's no operator
+func matchValue(fv reflect.Value, op string, value interface{}) bool {
+	if isIntervalOperator(op) {
+		t, _ := inferFieldType(fv.Type())
+		bounds, err := intervalBounds(t, op, value)
+		if err != nil || (fv.Kind() == reflect.Ptr && fv.IsNil()) {
+			return false
+		}
+		for _, b := range bounds {
+			if !matchValue(fv, b.op, b.value) {
+				return false
+			}
+		}
+		return true
+	}
+	if values, ok := value.([]interface{}); ok {
+		for _, v := range values {
+			if compareField(fv, v) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	isNil := (fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface) && fv.IsNil()
+	if value == nil || op == "isnull" {
+		want := true
+		if op == "isnull" {
+			if b, err := FieldBool.Parse(value); err == nil {
+				want = b.(bool)
+			}
+		}
+		return isNil == want
+	}
+	if isNil {
+		return false
+	}
+	text := strings.ToLower(formatFieldValue(reflect.Indirect(fv).Interface()))
+	filter := strings.ToLower(formatFieldValue(value))
+	switch op {
+	case "":
+		if reflect.Indirect(fv).Kind() == reflect.String {
+			return strings.HasPrefix(text, filter)
+		}
+		return compareField(fv, value) == 0
+	case "exact":
+		return formatFieldValue(reflect.Indirect(fv).Interface()) == formatFieldValue(value)
+	case "iexact":
+		return text == filter
+	case "contains":
+		return strings.Contains(formatFieldValue(reflect.Indirect(fv).Interface()), formatFieldValue(value))
+	case "icontains":
+		return strings.Contains(text, filter)
+	case "startswith":
+		return strings.HasPrefix(formatFieldValue(reflect.Indirect(fv).Interface()), formatFieldValue(value))
+	case "istartswith":
+		return strings.HasPrefix(text, filter)
+	case "endswith":
+		return strings.HasSuffix(formatFieldValue(reflect.Indirect(fv).Interface()), formatFieldValue(value))
+	case "iendswith":
+		return strings.HasSuffix(text, filter)
+	case "gt":
+		return compareField(fv, value) > 0
+	case "gte":
+		return compareField(fv, value) >= 0
+	case "lt":
+		return compareField(fv, value) < 0
+	case "lte":
+		return compareField(fv, value) <= 0
+	}
+	return false
+}
+
+// compareField compares a field value with a value converted to the type of the field, returning -1, 0 or 1
+func compareField(fv reflect.Value, value interface{}) int {
+	if v, ok := value.(reflect.Value); ok {
+		value = v.Interface()
+	}
+	if (fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface) && fv.IsNil() {
+		if value == nil || (reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil()) {
+			return 0
+		}
+		return -1
+	}
+	fv = reflect.Indirect(fv)
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return 1
+		}
+		value = v.Elem().Interface()
+	}
+	t, _ := inferFieldType(fv.Type())
+	if fv.Kind() == reflect.Bool {
+		t = FieldBool
+	}
+	switch t {
+	case FieldInt, FieldFloat:
+		parsed, err := FieldFloat.Parse(numberValue(value))
+		if err != nil {
+			break
+		}
+		return compareFloats(reflectFloat(fv), parsed.(float64))
+	case FieldBool:
+		parsed, err := FieldBool.Parse(value)
+		if err != nil {
+			break
+		}
+		a, b := fv.Bool(), parsed.(bool)
+		if a == b {
+			return 0
+		} else if b {
+			return -1
+		}
+		return 1
+	case FieldDate:
+		d, ok := value.(time.Time)
+		if !ok {
+			parsed, err := FieldDate.Parse(value)
+			if err != nil {
+				break
+			}
+			d = parsed.(time.Time)
+		}
+		a := fv.Interface().(time.Time)
+		if a.Before(d) {
+			return -1
+		} else if a.After(d) {
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(formatFieldValue(fv.Interface()), formatFieldValue(value))
+}
+
+// numberValue converts numeric Go values to float64, so they can be parsed as FieldFloat
+func numberValue(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return reflectFloat(v)
+	}
+	return value
+}
+
+func reflectFloat(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+func compareFloats(a, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func copyValue(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	return c
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
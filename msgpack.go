@@ -0,0 +1,219 @@
+package ngago
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"reflect"
+	"strings"
+)
+
+// MsgpackContentType is the media type clients send in the Accept header to receive msgpack responses
+const MsgpackContentType = "application/msgpack"
+
+// acceptsMsgpack tells if the Accept header asks for msgpack, in any of its media types
+func acceptsMsgpack(accept string) bool {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(mediaRange)
+		if err == nil && (mediaType == MsgpackContentType || mediaType == "application/x-msgpack") {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+encodeMsgpack encodes data in the msgpack format. Data is first converted with represent, so the
+encoded maps have the same keys, in the same order, as the JSON representation of data. Values with a
+custom JSON encoding (json.Marshaler, like time.Time) are encoded as the value their JSON decodes to
+*/
+func encodeMsgpack(data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeMsgpack(&buf, represent(data)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeMsgpack(buf *bytes.Buffer, data interface{}) error {
+	switch d := data.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+		return nil
+	case *object:
+		writeMsgpackHeader(buf, len(d.keys), 0x80, 0xde, 0xdf)
+		for _, k := range d.keys {
+			writeMsgpackString(buf, k)
+			if err := writeMsgpack(buf, d.values[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		writeMsgpackHeader(buf, len(d), 0x90, 0xdc, 0xdd)
+		for _, item := range d {
+			if err := writeMsgpack(buf, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case json.RawMessage:
+		return writeMsgpackJSON(buf, d)
+	case json.Number:
+		if i, err := d.Int64(); err == nil {
+			writeMsgpackInt(buf, i)
+			return nil
+		}
+		f, err := d.Float64()
+		if err != nil {
+			return err
+		}
+		writeMsgpackFloat(buf, f)
+		return nil
+	case []byte:
+		writeMsgpackBinary(buf, d)
+		return nil
+	}
+
+	v := reflect.ValueOf(data)
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeMsgpackInt(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeMsgpackUint(buf, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		writeMsgpackFloat(buf, v.Float())
+	case reflect.String:
+		writeMsgpackString(buf, v.String())
+	default:
+		return fmt.Errorf("ngago: cannot encode %T as msgpack", data)
+	}
+	return nil
+}
+
+// writeMsgpackJSON encodes a JSON value, keeping the order of the keys of its objects
+func writeMsgpackJSON(buf *bytes.Buffer, raw json.RawMessage) error {
+	if obj, ok := decodeObject(raw); ok {
+		return writeMsgpack(buf, obj)
+	}
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return err
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			list[i] = item
+		}
+		return writeMsgpack(buf, list)
+	}
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return err
+	}
+	return writeMsgpack(buf, value)
+}
+
+func writeMsgpackHeader(buf *bytes.Buffer, n int, fix, b16, b32 byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(b16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(b32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+func writeMsgpackString(buf *bytes.Buffer, s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xda)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(0xdb)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+	buf.WriteString(s)
+}
+
+func writeMsgpackBinary(buf *bytes.Buffer, b []byte) {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xc4)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xc5)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(0xc6)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+	buf.Write(b)
+}
+
+func writeMsgpackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0:
+		writeMsgpackUint(buf, uint64(i))
+	case i >= -32:
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(i))
+	case i >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(i))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, i)
+	}
+}
+
+func writeMsgpackUint(buf *bytes.Buffer, u uint64) {
+	switch {
+	case u < 128:
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		buf.WriteByte(0xcc)
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		binary.Write(buf, binary.BigEndian, uint16(u))
+	case u <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		binary.Write(buf, binary.BigEndian, uint32(u))
+	default:
+		buf.WriteByte(0xcf)
+		binary.Write(buf, binary.BigEndian, u)
+	}
+}
+
+func writeMsgpackFloat(buf *bytes.Buffer, f float64) {
+	buf.WriteByte(0xcb)
+	binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+}
@@ -0,0 +1,109 @@
+package ngago
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The expected bytes follow the formats of the msgpack spec, using the smallest one for each value:
+// https://github.com/msgpack/msgpack/blob/master/spec.md
+func TestEncodeMsgpack(t *testing.T) {
+	tests := []struct {
+		data     interface{}
+		expected string
+	}{
+		{nil, "c0"},
+		{true, "c3"},
+		{false, "c2"},
+		{0, "00"},
+		{127, "7f"},
+		{128, "cc80"},
+		{uint8(255), "ccff"},
+		{300, "cd012c"},
+		{70000, "ce00011170"},
+		{int64(1) << 40, "cf0000010000000000"},
+		{-1, "ff"},
+		{-32, "e0"},
+		{-33, "d0df"},
+		{-200, "d1ff38"},
+		{-70000, "d2fffeee90"},
+		{-(int64(1) << 40), "d3ffffff0000000000"},
+		{1.5, "cb3ff8000000000000"},
+		{float32(-2), "cbc000000000000000"},
+		{json.Number("42"), "2a"},
+		{json.Number("2.5"), "cb4004000000000000"},
+		{"", "a0"},
+		{"abc", "a3616263"},
+		{strings.Repeat("a", 32), "d920" + strings.Repeat("61", 32)},
+		{strings.Repeat("a", 256), "da0100" + strings.Repeat("61", 256)},
+		{[]int{}, "90"},
+		{[]interface{}{1, "a", nil}, "9301a161c0"},
+		{make([]int, 16), "dc0010" + strings.Repeat("00", 16)},
+		{map[string]interface{}{}, "80"},
+		{map[string]interface{}{"b": 1, "a": []string{"x"}}, "82a16191a178a16201"},
+		{time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC), "b4" + hex.EncodeToString([]byte("2016-01-02T03:04:05Z"))},
+		{json.RawMessage(`{"z":1,"a":[true,null]}`), "82a17a01a16192c3c0"},
+	}
+	for _, test := range tests {
+		encoded, err := encodeMsgpack(test.data)
+		if err != nil {
+			t.Errorf("%#v: %v", test.data, err)
+			continue
+		}
+		if got := hex.EncodeToString(encoded); got != test.expected {
+			t.Errorf("%#v: expected %s, got %s", test.data, test.expected, got)
+		}
+	}
+}
+
+func TestEncodeMsgpackStructs(t *testing.T) {
+	type point struct {
+		X     int
+		Y     float64 `json:"y"`
+		Label *string `json:"label"`
+		Skip  string  `json:"-"`
+	}
+	encoded, err := encodeMsgpack([]point{{X: 1, Y: math.Inf(1)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// JSON keys, in the order of the fields, and null for the nil pointer
+	expected := "9183a15801a179cb7ff0000000000000a56c6162656cc0"
+	if got := hex.EncodeToString(encoded); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestEncodeMsgpackRejectsUnsupportedValues(t *testing.T) {
+	if _, err := encodeMsgpack(map[string]interface{}{"fn": func() {}}); err == nil {
+		t.Error("expected an error for a func")
+	}
+}
+
+func TestMsgpackResponses(t *testing.T) {
+	resetBooks(t)
+	w := request("GET", "/books/3", "", "Accept", MsgpackContentType)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Type") != MsgpackContentType {
+		t.Errorf("expected a msgpack response, got %q", w.Header().Get("Content-Type"))
+	}
+	expected := "85" +
+		"a2" + hex.EncodeToString([]byte("Id")) + "03" +
+		"a5" + hex.EncodeToString([]byte("Title")) + "a4" + hex.EncodeToString([]byte("Dune")) +
+		"a5" + hex.EncodeToString([]byte("Pages")) + "cd019c" +
+		"a9" + hex.EncodeToString([]byte("Available")) + "c3" +
+		"a6" + hex.EncodeToString([]byte("Author")) + "83" +
+		"a2" + hex.EncodeToString([]byte("Id")) + "02" +
+		"a4" + hex.EncodeToString([]byte("Name")) + "a7" + hex.EncodeToString([]byte("Herbert")) +
+		"a5" + hex.EncodeToString([]byte("Books")) + "c0"
+	if got := hex.EncodeToString(w.Body.Bytes()); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
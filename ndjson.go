@@ -0,0 +1,101 @@
+package ngago
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// NDJSONContentType is the media type clients send in the Accept header to receive lists as
+// newline-delimited JSON, one entity per line
+const NDJSONContentType = "application/x-ndjson"
+
+func acceptsNDJSON(accept string) bool {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		if mediaType, _, err := mime.ParseMediaType(mediaRange); err == nil && mediaType == NDJSONContentType {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+serveNDJSON sends the entities selected by the options as newline-delimited JSON. The entities are read
+in chunks of DefaultChunkSize, and each chunk is written and flushed to the client before reading the
+next one, so the response is never fully held in memory. Once the first chunk is sent the status can't
+be changed anymore, so an error reading a later chunk just ends the response early
+*/
+func (c *BaseRESTController) serveNDJSON(options QueryOptions) {
+	remaining := options.Max
+	started := false
+	for {
+		size := DefaultChunkSize
+		if remaining > 0 && remaining < size {
+			size = remaining
+		}
+		chunkOptions := options
+		chunkOptions.Max = size
+		chunk := c.repo.NewSlice()
+		if err := c.repo.ReadAll(chunk, chunkOptions); err != nil {
+			c.log().Error(fmt.Sprintf("Error reading %s: %v", c.EntityName(), err))
+			if !started {
+				c.SendError("500", err.Error())
+			}
+			return
+		}
+		if !started {
+			if !c.skipsCount() {
+				count, _ := c.repo.Count(options)
+				c.Ctx.Output.Header("X-Total-Count", strconv.FormatInt(count, 10))
+			}
+			c.Ctx.Output.Header("Content-Type", NDJSONContentType)
+			c.sendWarnings()
+			c.Ctx.ResponseWriter.WriteHeader(http.StatusOK)
+			started = true
+		}
+		items := reflect.ValueOf(chunk).Elem()
+		for i := 0; i < items.Len(); i++ {
+			item := items.Index(i)
+			if item.Kind() != reflect.Ptr {
+				item = item.Addr()
+			}
+			line, err := json.Marshal(represent(c.applyView(item.Interface())))
+			if err != nil {
+				c.log().Error(fmt.Sprintf("Error encoding %s: %v", c.EntityName(), err))
+				return
+			}
+			if _, err := c.Ctx.ResponseWriter.Write(append(line, '\n')); err != nil {
+				c.log().Warn(fmt.Sprintf("Error sending %s: %v", c.EntityName(), err))
+				return
+			}
+		}
+		c.Ctx.ResponseWriter.Flush()
+		if paginator, ok := c.repo.(CursorPaginator); ok && options.After != "" && items.Len() > 0 {
+			// The Offset is ignored with cursors, so the next chunk starts after the last entity sent
+			last := items.Index(items.Len() - 1)
+			if last.Kind() != reflect.Ptr {
+				last = last.Addr()
+			}
+			cursor, err := paginator.Cursor(last.Interface(), options)
+			if err != nil {
+				c.log().Error(fmt.Sprintf("Error reading the cursor of %s: %v", c.EntityName(), err))
+				return
+			}
+			options.After = cursor
+		} else {
+			options.Offset += items.Len()
+		}
+		if remaining > 0 {
+			if remaining -= items.Len(); remaining <= 0 {
+				return
+			}
+		}
+		if items.Len() < size {
+			return
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package ngago
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/orm"
+)
+
+type StreamBookController struct {
+	BookController
+}
+
+func (c *StreamBookController) StreamLists() bool {
+	return true
+}
+
+func init() {
+	beego.Router("/stream/books", &StreamBookController{})
+}
+
+func TestNDJSONStreamsEachEntityAfterTheCursorOnce(t *testing.T) {
+	resetBooks(t)
+	o := orm.NewOrm()
+	for i := 4; i <= DefaultChunkSize+50; i++ {
+		if _, err := o.Insert(&Book{Id: int64(i), Title: fmt.Sprintf("Book %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cursor, err := NewRepository("book", Book{}).Cursor(&Book{Id: 1}, QueryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := request("GET", "/books?_cursor="+cursor, "", "Accept", NDJSONContentType)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != DefaultChunkSize+49 {
+		t.Fatalf("expected %d entities, got %d", DefaultChunkSize+49, len(lines))
+	}
+	for i, line := range lines {
+		var book Book
+		if err := json.Unmarshal([]byte(line), &book); err != nil {
+			t.Fatal(err)
+		}
+		if book.Id != int64(i+2) {
+			t.Fatalf("expected book %d in line %d, got %d", i+2, i+1, book.Id)
+		}
+	}
+}
+
+func TestStreamedListsAreNotClampedToTheMaxPerPage(t *testing.T) {
+	resetBooks(t)
+	defer func(max int) { MaxPerPage = max }(MaxPerPage)
+	MaxPerPage = 2
+	count := func(body []byte, ndjson bool) int {
+		if ndjson {
+			return len(strings.Split(strings.TrimSpace(string(body)), "\n"))
+		}
+		return len(decodeBooks(t, body))
+	}
+	tests := []struct {
+		url    string
+		ndjson bool
+		count  int
+	}{
+		{"/books", false, 2},
+		{"/books?_perPage=3", false, 2},
+		{"/books", true, 3},
+		{"/books?_perPage=3", true, 3},
+		{"/books?_perPage=1", true, 1},
+		{"/stream/books", false, 3},
+		{"/stream/books?_perPage=1&_page=2", false, 1},
+	}
+	for _, test := range tests {
+		var headers []string
+		if test.ndjson {
+			headers = []string{"Accept", NDJSONContentType}
+		}
+		w := request("GET", test.url, "", headers...)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", test.url, w.Code, w.Body.String())
+		}
+		if n := count(w.Body.Bytes(), test.ndjson); n != test.count {
+			t.Errorf("%s (NDJSON: %v): expected %d books, got %d", test.url, test.ndjson, test.count, n)
+		}
+	}
+}
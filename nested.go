@@ -0,0 +1,87 @@
+package ngago
+
+import (
+	"fmt"
+
+	"github.com/astaxie/beego/orm"
+)
+
+/*
+Controllers can implement this interface to serve a collection nested under a parent resource, ex: the
+books of an author. ParentFields maps fields of the entity, usually relations, to the route params with
+the parent ids, ex: {"Author": ":authorId"} for:
+
+	type AuthorBookController struct {
+		BookController
+	}
+
+	func (c *AuthorBookController) ParentFields() map[string]string {
+		return map[string]string{"Author": ":authorId"}
+	}
+
+	beego.Router("/authors/:authorId/books", &AuthorBookController{})
+	beego.Router("/authors/:authorId/books/:id", &AuthorBookController{})
+
+The repository, that must be a ParentScoper, then only lists, counts, reads, updates and deletes the books
+of the author in the URL, and creates the new ones with it, as TenantController does with the tenants.
+Parents without children, and missing ones, get an empty list. Parent ids of the wrong type are rejected
+with a 400
+*/
+type ParentController interface {
+	ParentFields() map[string]string
+}
+
+// ParentScoper is implemented by repositories that can restrict all their operations to the children of
+// a parent entity, as BaseRepository does
+type ParentScoper interface {
+	ScopeParent(field string, id interface{}) error
+}
+
+/*
+ScopeParent restricts the repository to the children of the parent with the id, ex: ScopeParent("Author",
+"5") for the books of the author 5. The field is a relation, set in the entities created and updated to
+the parent with the id, converted to the type of its primary key, or else a column, scoped as ScopeTenant
+does. An error is returned if the id can't be converted
+*/
+func (r *BaseRepository) ScopeParent(field string, id interface{}) error {
+	f, ok := findField(r.instanceType, field)
+	if !ok || !isRelation(f) {
+		return r.ScopeTenant(field, id)
+	}
+	v, err := fieldValueOf(primaryKey(f.Type), id)
+	if err != nil {
+		return fmt.Errorf("ngago: invalid parent %v for %s: %v", id, r.table, err)
+	}
+	r.tenants = append(r.tenants, tenantValue{field: f, value: v})
+	r.AddScope(func(qs orm.QuerySeter) orm.QuerySeter {
+		return qs.Filter(f.Name, v.Interface())
+	})
+	return nil
+}
+
+// scopeParent scopes the repository to the parents in the route params, for ParentControllers
+func (c *BaseRESTController) scopeParent() {
+	ctrl, ok := c.AppController.(ParentController)
+	if !ok {
+		return
+	}
+	scoper, ok := c.repo.(ParentScoper)
+	if !ok {
+		msg := fmt.Sprintf("Nested routes not supported for %s", c.EntityName())
+		c.log().Error(msg)
+		c.SendError("500", msg)
+	}
+	for field, param := range ctrl.ParentFields() {
+		id := c.Ctx.Input.Param(param)
+		if id == "" {
+			msg := fmt.Sprintf("Route of %s has no %s param", c.EntityName(), param)
+			c.log().Error(msg)
+			c.SendError("500", msg)
+		}
+		if err := scoper.ScopeParent(field, id); err != nil {
+			msg := fmt.Sprintf("Invalid %s %#v for %s", field, id, c.EntityName())
+			c.log().Warn(msg)
+			c.SendError("400", msg)
+		}
+	}
+}
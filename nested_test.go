@@ -0,0 +1,75 @@
+package ngago
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/astaxie/beego"
+)
+
+type AuthorBookController struct {
+	BookController
+}
+
+func (c *AuthorBookController) ParentFields() map[string]string {
+	return map[string]string{"Author": ":authorId"}
+}
+
+func init() {
+	beego.Router("/authors/:authorId/books", &AuthorBookController{})
+	beego.Router("/authors/:authorId/books/:id", &AuthorBookController{})
+}
+
+func TestNestedListsOnlyHaveTheChildrenOfTheParent(t *testing.T) {
+	resetBooks(t)
+	w := request("GET", "/authors/1/books?_sortField=Id", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	books := decodeBooks(t, w.Body.Bytes())
+	if len(books) != 2 || books[0].Title != "The Hobbit" || books[1].Title != "The Silmarillion" {
+		t.Errorf("expected the books of Tolkien, got %+v", books)
+	}
+	if w.Header().Get("X-Total-Count") != "2" {
+		t.Errorf("expected X-Total-Count 2, got %q", w.Header().Get("X-Total-Count"))
+	}
+	if books := decodeBooks(t, request("GET", "/authors/9/books", "").Body.Bytes()); len(books) != 0 {
+		t.Errorf("expected no books for a missing author, got %+v", books)
+	}
+}
+
+func TestNestedEntitiesOfOtherParentsAreNotFound(t *testing.T) {
+	resetBooks(t)
+	if w := request("GET", "/authors/1/books/3", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for the book of another author, got %d", w.Code)
+	}
+	if w := request("GET", "/authors/2/books/3", ""); w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestNestedEntitiesAreCreatedWithTheParent(t *testing.T) {
+	resetBooks(t)
+	w := request("POST", "/authors/2/books", `{"Title":"Children of Dune","Author":{"Id":1}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct{ Id int64 }
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if location := w.Header().Get("Location"); location != fmt.Sprintf("/authors/2/books/%d", created.Id) {
+		t.Errorf("expected the nested URL in the Location header, got %q", location)
+	}
+	book := &Book{}
+	NewRepository("book", Book{}).Read(created.Id, book)
+	if book.Author == nil || book.Author.Id != 2 {
+		t.Errorf("expected the book to be created for the author 2, got %+v", book)
+	}
+}
+
+func TestNestedRoutesRejectInvalidParentIds(t *testing.T) {
+	if w := request("GET", "/authors/x/books", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+}
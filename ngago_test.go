@@ -0,0 +1,104 @@
+package ngago
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/orm"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Models and routes used by the tests are registered by the init functions of their files, before the
+// database is created by TestMain
+
+type Author struct {
+	Id    int64
+	Name  string
+	Books []*Book `orm:"reverse(many)"`
+}
+
+type Book struct {
+	Id        int64
+	Title     string `orm:"unique"`
+	Pages     int
+	Available bool
+	Author    *Author `orm:"rel(fk);null"`
+}
+
+type BookController struct {
+	BaseRESTController
+}
+
+func (c *BookController) NewRepo() Repository {
+	return NewRepository("book", Book{})
+}
+
+func (c *BookController) Id(entity interface{}) int64 {
+	return entity.(*Book).Id
+}
+
+func init() {
+	orm.RegisterModel(new(Author), new(Book))
+	beego.Router("/books", &BookController{})
+	beego.Router("/books/:id", &BookController{})
+}
+
+func TestMain(m *testing.M) {
+	orm.RegisterDriver("sqlite3", orm.DRSqlite)
+	orm.RegisterDataBase("default", "sqlite3", "file::memory:?cache=shared")
+	if err := orm.RunSyncdb("default", false, false); err != nil {
+		panic(err)
+	}
+	// A database without tables, where all the queries fail
+	orm.RegisterDataBase("empty", "sqlite3", "file:empty?mode=memory&cache=shared")
+	beego.BConfig.CopyRequestBody = true
+	beego.BConfig.RunMode = beego.PROD
+	beego.SetLevel(beego.LevelCritical)
+	os.Exit(m.Run())
+}
+
+// resetBooks replaces the authors and books with two authors: Tolkien (1), with The Hobbit (1) and The
+// Silmarillion (2), and Herbert (2), with Dune (3)
+func resetBooks(t *testing.T) {
+	o := orm.NewOrm()
+	for _, table := range []string{"book", "author"} {
+		if _, err := o.Raw("DELETE FROM " + table).Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tolkien, herbert := &Author{Id: 1, Name: "Tolkien"}, &Author{Id: 2, Name: "Herbert"}
+	books := []interface{}{
+		tolkien, herbert,
+		&Book{Id: 1, Title: "The Hobbit", Pages: 310, Available: true, Author: tolkien},
+		&Book{Id: 2, Title: "The Silmarillion", Pages: 365, Author: tolkien},
+		&Book{Id: 3, Title: "Dune", Pages: 412, Available: true, Author: herbert},
+	}
+	for _, b := range books {
+		if _, err := o.Insert(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// request sends a request to the app, with the headers given as name and value pairs
+func request(method, url, body string, headers ...string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	beego.BeeApp.Handlers.ServeHTTP(w, req)
+	return w
+}
+
+func countRows(t *testing.T, table string) int64 {
+	var count int64
+	if err := orm.NewOrm().Raw("SELECT COUNT(*) FROM " + table).QueryRow(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
@@ -0,0 +1,66 @@
+package ngago
+
+import "strings"
+
+// SafeOperators are the orm operators allowed by default in filter keys with an operator suffix
+var SafeOperators = []string{
+	"exact", "iexact", "contains", "icontains", "startswith", "istartswith", "endswith", "iendswith",
+	"gt", "gte", "lt", "lte", "in", "isnull",
+}
+
+/*
+RangeSuffixes are recognized in filter keys even when no OperatorConvention is set, ex: price_gte=10 and
+price_lte=50 select the entities with a price between 10 and 50, and created_gt=2016-01-01 the ones
+created after that date. They are reserved: a key is only split when it isn't itself a field name, and
+what's left is a field name, so a field named "total_lt" is still filtered as is.
+*/
+var RangeSuffixes = []string{"_gte", "_lte", "_gt", "_lt"}
+
+// NullSuffix is recognized in filter keys as the RangeSuffixes are, to select the entities with (true) or
+// without (false) a null field, ex: assignee_isnull=true for unassigned tickets. A filter value is never
+// taken as null, so a field can still be matched with the "null" string
+const NullSuffix = "_isnull"
+
+/*
+OperatorConvention splits a filter key into a field and an operator, returning ok = false when the key
+has no operator suffix. Operators that are not allowed by the repository are ignored, and the key is
+handled as a plain field name. See BaseRepository.SetOperatorConvention
+*/
+type OperatorConvention func(key string) (field, operator string, ok bool)
+
+var (
+	// UnderscoreOperators recognizes operators as in price_gte=10
+	UnderscoreOperators = SuffixOperators("_", "")
+	// DotOperators recognizes operators as in price.gte=10
+	DotOperators = SuffixOperators(".", "")
+	// BracketOperators recognizes operators as in price[gte]=10
+	BracketOperators = SuffixOperators("[", "]")
+)
+
+// defaultOperator splits a filter key ending with one of the RangeSuffixes, the IntervalSuffixes or the
+// NullSuffix into a field and an operator
+func defaultOperator(key string) (string, string, bool) {
+	suffixes := append(append(RangeSuffixes[:len(RangeSuffixes):len(RangeSuffixes)], IntervalSuffixes...), NullSuffix)
+	for _, suffix := range suffixes {
+		if len(key) > len(suffix) && strings.HasSuffix(key, suffix) {
+			return key[:len(key)-len(suffix)], suffix[1:], true
+		}
+	}
+	return "", "", false
+}
+
+// SuffixOperators creates an OperatorConvention for operators appended to the field name, between
+// the open and close strings
+func SuffixOperators(open, close string) OperatorConvention {
+	return func(key string) (string, string, bool) {
+		if !strings.HasSuffix(key, close) {
+			return "", "", false
+		}
+		key = strings.TrimSuffix(key, close)
+		i := strings.LastIndex(key, open)
+		if i <= 0 || i+len(open) == len(key) {
+			return "", "", false
+		}
+		return key[:i], key[i+len(open):], true
+	}
+}
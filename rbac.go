@@ -0,0 +1,104 @@
+package ngago
+
+import "strings"
+
+// Access categories of the actions, as returned by ActionCategory
+const (
+	AccessRead   = "read"
+	AccessWrite  = "write"
+	AccessDelete = "delete"
+)
+
+/*
+ActionCategory classifies an action received by AccessControl, either a controller action, ex: "Get" or
+"DeleteMany", or a HTTP method, ex: "POST", as AccessRead, AccessWrite or AccessDelete. Actions that
+don't modify entities, like "Summary", "Aggregate", "Distinct" and "Permissions", are AccessRead. Unknown
+actions are AccessWrite, so they're never allowed by mistake to profiles that can only read
+*/
+func ActionCategory(action string) string {
+	switch strings.ToLower(action) {
+	case "get", "head", "options", "summary", "aggregate", "distinct", "permissions":
+		return AccessRead
+	case "delete", "deletemany":
+		return AccessDelete
+	}
+	return AccessWrite
+}
+
+/*
+RoleAccess implements AccessControl for controllers that authorize by profile (role). It maps each access
+category to the profiles allowed to perform its actions, ex:
+
+	var userAccess = ngago.RoleAccess{
+		ngago.AccessRead:   {"*"},
+		ngago.AccessWrite:  {"editor", "admin"},
+		ngago.AccessDelete: {"admin"},
+		"Batch":            {"admin"},
+	}
+
+	func (c *UserController) AccessControl(controller, action, url, profile string) bool {
+		return userAccess.AccessControl(controller, action, url, profile)
+	}
+
+Keys can also be action names, ex: "Batch", that take precedence over the category of the action. The
+"*" profile matches any profile, even an empty one. Actions of categories not in the map are denied
+*/
+type RoleAccess map[string][]string
+
+func (a RoleAccess) AccessControl(controller, action, url, profile string) bool {
+	profiles, ok := a.profiles(action)
+	if !ok {
+		profiles = a[ActionCategory(action)]
+	}
+	for _, p := range profiles {
+		if p == "*" || p == profile {
+			return true
+		}
+	}
+	return false
+}
+
+// profiles returns the profiles declared for an action name, matched case insensitively
+func (a RoleAccess) profiles(action string) ([]string, bool) {
+	for k, profiles := range a {
+		if k != AccessRead && k != AccessWrite && k != AccessDelete && strings.EqualFold(k, action) {
+			return profiles, true
+		}
+	}
+	return nil, false
+}
+
+// Operation is the REST operation performed by a request, as received by AccessOperation
+type Operation string
+
+const (
+	OpList   Operation = "list"
+	OpRead   Operation = "read"
+	OpCreate Operation = "create"
+	OpUpdate Operation = "update"
+	OpDelete Operation = "delete"
+)
+
+/*
+operationOf maps an action, a controller action or a HTTP method, to its Operation. GET is OpRead when the
+URL references an entity, otherwise OpList, as are the other actions that only read, ex: Summary. The
+actions mapped explicitly that are not known, ex: "Batch", are returned as their lowercased name
+*/
+func operationOf(action string, hasId bool) Operation {
+	switch strings.ToLower(action) {
+	case "get", "head":
+		if hasId {
+			return OpRead
+		}
+		return OpList
+	case "summary", "aggregate", "distinct", "permissions", "options":
+		return OpList
+	case "post":
+		return OpCreate
+	case "put", "patch", "updatemany":
+		return OpUpdate
+	case "delete", "deletemany":
+		return OpDelete
+	}
+	return Operation(strings.ToLower(action))
+}
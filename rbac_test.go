@@ -0,0 +1,51 @@
+package ngago
+
+import "testing"
+
+func TestActionCategory(t *testing.T) {
+	tests := map[string]string{
+		"Get": AccessRead, "HEAD": AccessRead, "Summary": AccessRead, "distinct": AccessRead,
+		"Permissions": AccessRead, "Post": AccessWrite, "PUT": AccessWrite, "UpdateMany": AccessWrite,
+		"Batch": AccessWrite, "Delete": AccessDelete, "DeleteMany": AccessDelete,
+	}
+	for action, expected := range tests {
+		if category := ActionCategory(action); category != expected {
+			t.Errorf("%s: expected %s, got %s", action, expected, category)
+		}
+	}
+}
+
+func TestRoleAccess(t *testing.T) {
+	access := RoleAccess{
+		AccessRead:   {"*"},
+		AccessWrite:  {"editor", "admin"},
+		AccessDelete: {"admin"},
+		"batch":      {"admin"},
+	}
+	tests := []struct {
+		action, profile string
+		allowed         bool
+	}{
+		{"Get", "", true},
+		{"Aggregate", "guest", true},
+		{"Post", "guest", false},
+		{"Put", "editor", true},
+		{"Delete", "editor", false},
+		{"DeleteMany", "admin", true},
+		// Action names take precedence over their category
+		{"Batch", "editor", false},
+		{"Batch", "admin", true},
+		// Unknown actions are writes
+		{"Publish", "guest", false},
+		{"Publish", "editor", true},
+	}
+	for _, test := range tests {
+		if allowed := access.AccessControl("BookController", test.action, "/books", test.profile); allowed != test.allowed {
+			t.Errorf("%s by %q: expected %v, got %v", test.action, test.profile, test.allowed, allowed)
+		}
+	}
+	// Actions of categories not in the map are denied
+	if (RoleAccess{AccessRead: {"*"}}).AccessControl("BookController", "Delete", "/books/1", "admin") {
+		t.Error("expected the delete to be denied")
+	}
+}
@@ -0,0 +1,324 @@
+package ngago
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	valuerType        = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// object is a JSON object that keeps its keys in insertion order, so entities are
+// represented with their fields in the same order as declared in the struct
+type object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newObject() *object {
+	return &object{values: make(map[string]interface{})}
+}
+
+func (o *object) Set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *object) Get(key string) (interface{}, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+func (o *object) Keys() []string {
+	return o.keys
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+/*
+represent converts data to a generic representation, made of *object, []interface{}, json.RawMessage
+and plain values, that serializes to the same JSON that encoding/json would produce for data, except
+that values implementing driver.Valuer (like sql.NullString and sql.NullInt64) are replaced by the
+value they hold, or null, instead of being serialized as {"String": "x", "Valid": true} objects.
+*/
+func represent(data interface{}) interface{} {
+	if obj, ok := data.(*object); ok {
+		return obj
+	}
+	return representValue(reflect.ValueOf(data))
+}
+
+// emptyIfNil replaces a nil list, or a pointer to one, with an empty list, so it's serialized as [] instead
+// of null. Any other data is returned unchanged
+func emptyIfNil(data interface{}) interface{} {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() || ((v.Kind() == reflect.Ptr || v.Kind() == reflect.Slice) && v.IsNil()) {
+		return []interface{}{}
+	}
+	return data
+}
+
+func representValue(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	t := v.Type()
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return nil
+	}
+	if s := reflect.Indirect(v); s.Kind() == reflect.Struct && hasPromotedMarshaler(s) {
+		obj := newObject()
+		representFields(obj, s, 0, make(map[string]int))
+		return obj
+	}
+	if m, ok := marshalerOf(v); ok {
+		return marshalJSON(m)
+	}
+	if t.Implements(valuerType) {
+		value, err := v.Interface().(driver.Valuer).Value()
+		if err != nil {
+			return nil
+		}
+		return representValue(reflect.ValueOf(value))
+	}
+	if t.Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil
+		}
+		return string(text)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return representValue(v.Elem())
+	case reflect.Struct:
+		obj := newObject()
+		representFields(obj, v, 0, make(map[string]int))
+		return obj
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		fallthrough
+	case reflect.Array:
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = representValue(v.Index(i))
+		}
+		return list
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		obj := newObject()
+		keys := make([]string, 0, v.Len())
+		values := make(map[string]reflect.Value, v.Len())
+		for _, k := range v.MapKeys() {
+			key := fmt.Sprint(k.Interface())
+			keys = append(keys, key)
+			values[key] = v.MapIndex(k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			obj.Set(k, representValue(values[k]))
+		}
+		return obj
+	}
+	return v.Interface()
+}
+
+// representFields adds the fields of the struct v to obj, following encoding/json rules for tags and
+// embedded structs. When names collide, the field closest to the outer struct wins
+func representFields(obj *object, v reflect.Value, depth int, depths map[string]int) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+		fv := v.Field(i)
+		if sf.Anonymous && name == "" && indirectType(sf.Type).Kind() == reflect.Struct {
+			for fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					break
+				}
+				fv = fv.Elem()
+			}
+			if m, ok := marshalerOf(fv); ok {
+				if embedded, ok := decodeObject(marshalJSON(m)); ok {
+					for _, k := range embedded.Keys() {
+						if d, ok := depths[k]; !ok || d > depth+1 {
+							depths[k] = depth + 1
+							obj.Set(k, embedded.values[k])
+						}
+					}
+				}
+			} else if fv.Kind() == reflect.Struct {
+				representFields(obj, fv, depth+1, depths)
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if hasOption(opts, "omitempty") && isEmptyValue(fv) {
+			continue
+		}
+		if d, ok := depths[name]; ok && d <= depth {
+			continue
+		}
+		depths[name] = depth
+		value := representValue(fv)
+		if hasOption(opts, "string") {
+			if b, err := json.Marshal(value); err == nil {
+				value = string(b)
+			}
+		}
+		obj.Set(name, value)
+	}
+}
+
+func marshalerOf(v reflect.Value) (json.Marshaler, bool) {
+	if !v.CanInterface() {
+		return nil, false
+	}
+	if v.Type().Implements(jsonMarshalerType) {
+		return v.Interface().(json.Marshaler), true
+	}
+	if v.CanAddr() && reflect.PtrTo(v.Type()).Implements(jsonMarshalerType) {
+		return v.Addr().Interface().(json.Marshaler), true
+	}
+	return nil, false
+}
+
+/*
+hasPromotedMarshaler tells if the MarshalJSON method of the struct v is promoted from one of its embedded
+structs, in which case encoding/json would serialize only the embedded struct, silently dropping all other
+fields. The method is considered promoted when it produces the same JSON as the embedded struct's method
+*/
+func hasPromotedMarshaler(v reflect.Value) bool {
+	outer, ok := marshalerOf(v)
+	if !ok {
+		return false
+	}
+	for i := 0; i < v.NumField(); i++ {
+		if !v.Type().Field(i).Anonymous {
+			continue
+		}
+		inner, ok := marshalerOf(reflect.Indirect(v.Field(i)))
+		if !ok {
+			continue
+		}
+		a, errA := outer.MarshalJSON()
+		b, errB := inner.MarshalJSON()
+		return errA == nil && errB == nil && bytes.Equal(a, b)
+	}
+	return false
+}
+
+// decodeObject parses a JSON object, keeping its keys order
+func decodeObject(data interface{}) (*object, bool) {
+	raw, ok := data.(json.RawMessage)
+	if !ok {
+		return nil, false
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, false
+	}
+	obj := newObject()
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, false
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, false
+		}
+		obj.Set(tok.(string), value)
+	}
+	return obj, true
+}
+
+func marshalJSON(m json.Marshaler) interface{} {
+	b, err := m.MarshalJSON()
+	if err != nil {
+		return nil
+	}
+	return json.RawMessage(b)
+}
+
+func hasOption(opts, option string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
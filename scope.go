@@ -0,0 +1,130 @@
+package ngago
+
+import "github.com/astaxie/beego/orm"
+
+// ScopeFunc restricts or configures the queries of a repository, ex: to only read the entities of the
+// current tenant, or the ones not archived. See BaseRepository.AddScope
+type ScopeFunc func(qs orm.QuerySeter) orm.QuerySeter
+
+/*
+AddScope adds a ScopeFunc applied at the start of all the queries of the repository: the ones reading
+entities, as Read, ReadAll and Count, and the ones updating or deleting by query, as Delete, DeleteMany
+and UpdateMany. Scopes are applied in the order they're added, and compose: their filters are ANDed with
+each other and with the filters of the options, and their ordering is used when the options have no sort
+and no After cursor, ex:
+
+	r.AddScope(func(qs orm.QuerySeter) orm.QuerySeter {
+		return qs.Filter("Archived", false).OrderBy("-CreatedAt")
+	})
+
+Save and Update write the entity itself, with no query, and so are not scoped
+*/
+func (r *BaseRepository) AddScope(scope ScopeFunc) {
+	r.scopes = append(r.scopes, scope)
+}
+
+// NewQuery starts a query of the repository table with the scopes applied, as the ones of Read and ReadAll.
+// Unlike the queries of Orm.QueryTable, the conditions added to it are kept by AddFilters
+func (r *BaseRepository) NewQuery() orm.QuerySeter {
+	return r.query(r.Orm)
+}
+
+// query starts a query of the repository table with o, with the scopes applied
+func (r *BaseRepository) query(o orm.Ormer) orm.QuerySeter {
+	var scoped orm.QuerySeter = &scopedQuery{QuerySeter: o.QueryTable(r.table), scope: orm.NewCondition(), cond: orm.NewCondition()}
+	for _, scope := range r.scopes {
+		scoped = scope(scoped)
+	}
+	if q, ok := scoped.(*scopedQuery); ok {
+		sealed := *q
+		sealed.scope, sealed.cond = andConds(q.scope, q.cond), orm.NewCondition()
+		sealed.sealed = true
+		return &sealed
+	}
+	return scoped
+}
+
+/*
+scopedQuery is a QuerySeter that keeps the conditions added to it, as the orm doesn't expose them, so
+AddFilters can AND its own instead of replacing them with SetCond. The conditions added by the scopes are
+kept apart, so they can't be replaced either. Until it's sealed, the conditions are the scopes' own
+*/
+type scopedQuery struct {
+	orm.QuerySeter
+	scope   *orm.Condition
+	cond    *orm.Condition
+	sealed  bool
+	ordered bool
+}
+
+func (q scopedQuery) with(cond *orm.Condition) orm.QuerySeter {
+	q.cond = cond
+	q.QuerySeter = q.QuerySeter.SetCond(andConds(q.scope, cond))
+	return &q
+}
+
+func (q scopedQuery) chain(qs orm.QuerySeter) orm.QuerySeter {
+	q.QuerySeter = qs
+	return &q
+}
+
+func (q *scopedQuery) Filter(expr string, args ...interface{}) orm.QuerySeter {
+	return q.with(q.cond.And(expr, args...))
+}
+
+func (q *scopedQuery) Exclude(expr string, args ...interface{}) orm.QuerySeter {
+	return q.with(q.cond.AndNot(expr, args...))
+}
+
+func (q *scopedQuery) SetCond(cond *orm.Condition) orm.QuerySeter {
+	if !q.sealed {
+		return q.with(andConds(q.cond, cond))
+	}
+	if cond == nil {
+		cond = orm.NewCondition()
+	}
+	return q.with(cond)
+}
+
+func (q *scopedQuery) Limit(limit interface{}, args ...interface{}) orm.QuerySeter {
+	return q.chain(q.QuerySeter.Limit(limit, args...))
+}
+
+func (q *scopedQuery) Offset(offset interface{}) orm.QuerySeter {
+	return q.chain(q.QuerySeter.Offset(offset))
+}
+
+func (q *scopedQuery) GroupBy(exprs ...string) orm.QuerySeter {
+	return q.chain(q.QuerySeter.GroupBy(exprs...))
+}
+
+func (q *scopedQuery) OrderBy(exprs ...string) orm.QuerySeter {
+	ordered := *q
+	ordered.QuerySeter, ordered.ordered = q.QuerySeter.OrderBy(exprs...), true
+	return &ordered
+}
+
+func (q *scopedQuery) RelatedSel(params ...interface{}) orm.QuerySeter {
+	return q.chain(q.QuerySeter.RelatedSel(params...))
+}
+
+func (q *scopedQuery) Distinct() orm.QuerySeter {
+	return q.chain(q.QuerySeter.Distinct())
+}
+
+// isOrdered tells if an ordering was set for qs, ex: by a scope
+func isOrdered(qs orm.QuerySeter) bool {
+	q, ok := qs.(*scopedQuery)
+	return ok && q.ordered
+}
+
+// andConds combines two conditions with AND, skipping the empty ones
+func andConds(a, b *orm.Condition) *orm.Condition {
+	switch {
+	case b == nil || b.IsEmpty():
+		return a
+	case a == nil || a.IsEmpty():
+		return b
+	}
+	return orm.NewCondition().AndCond(a).AndCond(b)
+}
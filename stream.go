@@ -0,0 +1,143 @@
+package ngago
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+// Streamer is implemented by repositories that can read the entities one by one, without holding all of
+// them in memory, as BaseRepository does
+type Streamer interface {
+	ReadAllStream(fn func(entity interface{}) error, options ...QueryOptions) error
+}
+
+/*
+Controllers can implement this interface to send their lists as a JSON array written incrementally, as
+the entities are read with the repository's ReadAllStream, so the memory used doesn't grow with the size
+of the list. The repository must implement Streamer. Once the first entities are sent the status can't be
+changed anymore, so an error reading the list is logged and truncates the response
+*/
+type StreamController interface {
+	StreamLists() bool
+}
+
+/*
+ReadAllStream calls fn for each entity matching the options, in the options sort, reading them in chunks of
+DefaultChunkSize, so only one chunk is held in memory at a time. When the sort supports keyset pagination
+(see Cursor) each chunk is read after the last entity of the previous one, otherwise by offset. If fn
+returns an error, the reading stops and the error is returned. The options Max, if any, limits the number
+of entities read
+*/
+func (r *BaseRepository) ReadAllStream(fn func(entity interface{}) error, options ...QueryOptions) error {
+	var opt QueryOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+	_, _, keyset := r.keysetField(opt)
+	remaining := opt.Max
+	for {
+		size := DefaultChunkSize
+		if remaining > 0 && remaining < size {
+			size = remaining
+		}
+		chunkOptions := opt
+		chunkOptions.Max = size
+		chunk := r.NewSlice()
+		if err := r.self.ReadAll(chunk, chunkOptions); err != nil {
+			return err
+		}
+		items := reflect.ValueOf(chunk).Elem()
+		var last interface{}
+		for i := 0; i < items.Len(); i++ {
+			item := items.Index(i)
+			if item.Kind() != reflect.Ptr {
+				item = item.Addr()
+			}
+			last = item.Interface()
+			if err := fn(last); err != nil {
+				return err
+			}
+		}
+		if items.Len() < size {
+			return nil
+		}
+		if remaining > 0 {
+			if remaining -= items.Len(); remaining <= 0 {
+				return nil
+			}
+		}
+		if keyset {
+			cursor, err := r.Cursor(last, opt)
+			if err != nil {
+				return err
+			}
+			opt.After = cursor
+		} else {
+			opt.Offset += items.Len()
+		}
+	}
+}
+
+// streamer returns the repository's Streamer, when the controller streams its lists and the response is JSON
+func (c *BaseRESTController) streamer() (Streamer, bool) {
+	accept := c.Ctx.Input.Header("Accept")
+	ctrl, ok := c.AppController.(StreamController)
+	if !ok || !ctrl.StreamLists() || acceptsMsgpack(accept) || acceptsXML(c.AppController, accept) {
+		return nil, false
+	}
+	streamer, ok := c.repo.(Streamer)
+	return streamer, ok
+}
+
+// streamsList tells if the list is streamed to the client, as CSV, NDJSON or by a StreamController, instead
+// of being read whole before it's sent
+func (c *BaseRESTController) streamsList() bool {
+	if c.wantsCSV() || acceptsNDJSON(c.Ctx.Input.Header("Accept")) {
+		return true
+	}
+	_, ok := c.streamer()
+	return ok
+}
+
+// serveStream sends the entities selected by the options as a JSON array, written as they are read
+func (c *BaseRESTController) serveStream(streamer Streamer, options QueryOptions) {
+	count := int64(-1)
+	if !c.skipsCount() {
+		count, _ = c.repo.Count(options)
+		c.Ctx.Output.Header("X-Total-Count", strconv.FormatInt(count, 10))
+		c.Ctx.Output.Header("X-Total-Pages", strconv.FormatInt(totalPages(count, options.Max), 10))
+	}
+	if link := c.pageLinks(options, count, false); link != "" {
+		c.Ctx.Output.Header("Link", link)
+	}
+	c.Ctx.Output.Header("Content-Type", "application/json; charset=utf-8")
+	c.sendWarnings()
+	c.Ctx.ResponseWriter.WriteHeader(http.StatusOK)
+	w := c.Ctx.ResponseWriter
+	w.Write([]byte("["))
+	n := 0
+	err := streamer.ReadAllStream(func(entity interface{}) error {
+		item, err := json.Marshal(represent(c.applyView(entity)))
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			w.Write([]byte(","))
+		}
+		if _, err := w.Write(item); err != nil {
+			return err
+		}
+		if n++; n%DefaultChunkSize == 0 {
+			w.Flush()
+		}
+		return nil
+	}, options)
+	if err != nil {
+		c.log().Error(fmt.Sprintf("Error streaming %s, response truncated: %v", c.EntityName(), err))
+		return
+	}
+	w.Write([]byte("]"))
+}
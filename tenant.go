@@ -0,0 +1,130 @@
+package ngago
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/astaxie/beego/orm"
+)
+
+/*
+Controllers can implement this interface to restrict all their requests to the entities of the caller's
+tenant. TenantFields maps fields of the entity to the Ctx.Input data entries with the caller's tenant,
+set by an authentication filter as the profile is, ex: {"TenantId": "tenant"}. The repository, that must
+be a TenantScoper, then only reads, updates and deletes the entities of that tenant, and creates the new
+ones in it. Clients can't override it: their filters by the tenant fields are ANDed with it, and their
+values for the tenant fields are replaced. Requests without the tenant data are rejected with a 401
+*/
+type TenantController interface {
+	TenantFields() map[string]string
+}
+
+// TenantScoper is implemented by repositories that can restrict all their operations to the entities of
+// a tenant, as BaseRepository does
+type TenantScoper interface {
+	ScopeTenant(field string, value interface{}) error
+}
+
+// tenantValue is the value of a tenant field, converted to the field type, or of a parent relation, see
+// ScopeParent, as the primary key of the related entity
+type tenantValue struct {
+	field entityField
+	value reflect.Value
+}
+
+// fieldValue returns the value set in the field of the entities, a new related entity with the primary key
+// for relations
+func (t tenantValue) fieldValue() reflect.Value {
+	if !isRelation(t.field) {
+		return t.value
+	}
+	rel := reflect.New(indirectType(t.field.Type))
+	rel.Elem().FieldByIndex(primaryKey(t.field.Type).Index).Set(t.value)
+	if t.field.Type.Kind() != reflect.Ptr {
+		return rel.Elem()
+	}
+	return rel
+}
+
+/*
+ScopeTenant restricts the repository to the entities with the value in the field, ex: ScopeTenant("TenantId",
+5): the field is filtered by a scope, see AddScope, and set to the value in the entities created and updated
+by Save, Update, Upsert, UpdateMany and SyncChildren. Entities of other tenants are not found by Update,
+that returns ErrNotFound, as Read does. The field must be a column of the entity, not a relation, and the
+value is converted to its type, ex: from the "5" string, or an error is returned
+*/
+func (r *BaseRepository) ScopeTenant(field string, value interface{}) error {
+	f, ok := findField(r.instanceType, field)
+	if !ok || isEntityRef(f) {
+		panic(fmt.Sprintf("ngago: invalid tenant field %s for %s", field, r.table))
+	}
+	v, err := fieldValueOf(f, value)
+	if err != nil {
+		return fmt.Errorf("ngago: invalid tenant %v for %s: %v", value, r.table, err)
+	}
+	r.tenants = append(r.tenants, tenantValue{field: f, value: v})
+	r.AddScope(func(qs orm.QuerySeter) orm.QuerySeter {
+		return qs.Filter(f.Name, v.Interface())
+	})
+	return nil
+}
+
+// fieldValueOf converts a value to the type of the field, parsing it as a filter value when it's not
+// convertible, ex: "5" for an int64 field
+func fieldValueOf(f entityField, value interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return v, fmt.Errorf("a value is expected")
+	}
+	if v.Type() != f.Type && (v.Kind() == reflect.String) != (f.Type.Kind() == reflect.String) {
+		t, _ := inferFieldType(f.Type)
+		parsed, err := t.Parse(formatFieldValue(value))
+		if err != nil {
+			return v, err
+		}
+		v = reflect.ValueOf(parsed)
+	}
+	if !v.Type().ConvertibleTo(f.Type) {
+		return v, fmt.Errorf("a %s is expected", f.Type)
+	}
+	return v.Convert(f.Type), nil
+}
+
+// setTenants sets the tenant fields of an entity to the values of ScopeTenant
+func (r *BaseRepository) setTenants(p interface{}) {
+	e := reflect.Indirect(reflect.ValueOf(p))
+	for _, t := range r.tenants {
+		e.FieldByIndex(t.field.Index).Set(t.fieldValue())
+	}
+}
+
+// inScope tells if the entity with the id of p is found by the queries of the repository, that are scoped
+func (r *BaseRepository) inScope(o orm.Ormer, p interface{}) (bool, error) {
+	count, err := r.query(o).Filter(r.idField.Name, r.idOf(p)).Count()
+	return count > 0, err
+}
+
+// scopeTenant scopes the repository to the tenant of the caller, for TenantControllers
+func (c *BaseRESTController) scopeTenant() {
+	ctrl, ok := c.AppController.(TenantController)
+	if !ok {
+		return
+	}
+	scoper, ok := c.repo.(TenantScoper)
+	if !ok {
+		msg := fmt.Sprintf("Tenant scoping not supported for %s", c.EntityName())
+		c.log().Error(msg)
+		c.SendError("500", msg)
+	}
+	for field, key := range ctrl.TenantFields() {
+		value := c.Ctx.Input.GetData(key)
+		if value == nil || value == "" {
+			c.log().Warn(fmt.Sprintf("Access denied to %s without a tenant in %#v", c.EntityName(), key))
+			c.SendError("401", "Access denied!")
+		}
+		if err := scoper.ScopeTenant(field, value); err != nil {
+			c.log().Error(err.Error())
+			c.SendError("500", err.Error())
+		}
+	}
+}
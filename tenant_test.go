@@ -0,0 +1,125 @@
+package ngago
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/context"
+	"github.com/astaxie/beego/orm"
+)
+
+type Invoice struct {
+	Id       int64
+	Number   string
+	TenantId int64
+}
+
+type InvoiceController struct {
+	BaseRESTController
+}
+
+func (c *InvoiceController) NewRepo() Repository {
+	return NewRepository("invoice", Invoice{})
+}
+
+func (c *InvoiceController) Id(entity interface{}) int64 {
+	return entity.(*Invoice).Id
+}
+
+func (c *InvoiceController) TenantFields() map[string]string {
+	return map[string]string{"TenantId": "tenant"}
+}
+
+func init() {
+	orm.RegisterModel(new(Invoice))
+	beego.Router("/invoices", &InvoiceController{})
+	beego.Router("/invoices/:id", &InvoiceController{})
+	// Stands for the authentication filter, that sets the tenant of the caller
+	setTenant := func(ctx *context.Context) {
+		if tenant := ctx.Input.Header("X-Tenant"); tenant != "" {
+			ctx.Input.SetData("tenant", tenant)
+		}
+	}
+	beego.InsertFilter("/invoices", beego.BeforeExec, setTenant)
+	beego.InsertFilter("/invoices/*", beego.BeforeExec, setTenant)
+}
+
+// resetInvoices replaces the invoices with A-1 (1) and A-2 (2) of the tenant 1, and B-1 (3) of the tenant 2
+func resetInvoices(t *testing.T) {
+	o := orm.NewOrm()
+	o.Raw("DELETE FROM invoice").Exec()
+	for _, i := range []*Invoice{{1, "A-1", 1}, {2, "A-2", 1}, {3, "B-1", 2}} {
+		if _, err := o.Insert(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func decodeInvoices(t *testing.T, body []byte) []Invoice {
+	var invoices []Invoice
+	if err := json.Unmarshal(body, &invoices); err != nil {
+		t.Fatalf("expected a list of invoices, got %s: %v", body, err)
+	}
+	return invoices
+}
+
+func TestTenantsOnlyListTheirEntities(t *testing.T) {
+	resetInvoices(t)
+	w := request("GET", "/invoices", "", "X-Tenant", "2")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if invoices := decodeInvoices(t, w.Body.Bytes()); len(invoices) != 1 || invoices[0].Number != "B-1" {
+		t.Errorf("expected only B-1, got %+v", invoices)
+	}
+	if w.Header().Get("X-Total-Count") != "1" {
+		t.Errorf("expected X-Total-Count 1, got %q", w.Header().Get("X-Total-Count"))
+	}
+}
+
+func TestTenantFiltersCantBeOverridden(t *testing.T) {
+	resetInvoices(t)
+	w := request("GET", "/invoices?TenantId=1", "", "X-Tenant", "2")
+	if invoices := decodeInvoices(t, w.Body.Bytes()); len(invoices) != 0 {
+		t.Errorf("expected no invoices of the tenant 1, got %+v", invoices)
+	}
+}
+
+func TestCrossTenantAccessIsBlocked(t *testing.T) {
+	resetInvoices(t)
+	for _, method := range []string{"GET", "PUT", "PATCH", "DELETE"} {
+		w := request(method, "/invoices/1", `{"Id":1,"Number":"stolen"}`, "X-Tenant", "2")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d: %s", method, w.Code, w.Body.String())
+		}
+	}
+	stored := &Invoice{}
+	if err := orm.NewOrm().QueryTable("invoice").Filter("Id", 1).One(stored); err != nil {
+		t.Fatalf("expected the invoice to be kept: %v", err)
+	}
+	if stored.Number != "A-1" || stored.TenantId != 1 {
+		t.Errorf("expected the invoice to be unchanged, got %+v", stored)
+	}
+}
+
+func TestEntitiesAreCreatedInTheCallersTenant(t *testing.T) {
+	resetInvoices(t)
+	w := request("POST", "/invoices", `{"Number":"B-2","TenantId":1}`, "X-Tenant", "2")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	stored := &Invoice{}
+	orm.NewOrm().QueryTable("invoice").Filter("Number", "B-2").One(stored)
+	if stored.TenantId != 2 {
+		t.Errorf("expected the invoice to be created in the tenant 2, got %+v", stored)
+	}
+}
+
+func TestRequestsWithoutATenantAreRejected(t *testing.T) {
+	w := request("GET", "/invoices", "")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,81 @@
+package ngago
+
+import "github.com/astaxie/beego/orm"
+
+/*
+WithTx runs fn in a transaction of the database alias, or of the default alias when not given. The
+transaction is committed when fn returns nil, and rolled back when it returns an error or panics. To
+write with many repositories in the same transaction, create them bound to tx inside fn, with
+NewRepository or passing tx to their Init, ex:
+
+	err := ngago.WithTx(func(tx orm.Ormer) error {
+		if _, err := ngago.NewRepository("invoice", Invoice{}, tx).Save(invoice); err != nil {
+			return err
+		}
+		_, err := ngago.NewRepository("invoice_line", InvoiceLine{}, tx).Save(line)
+		return err
+	})
+*/
+func WithTx(fn func(tx orm.Ormer) error, alias ...string) (err error) {
+	o := orm.NewOrm()
+	if len(alias) > 0 {
+		if err = o.Using(alias[0]); err != nil {
+			return err
+		}
+	}
+	if err = o.Begin(); err != nil {
+		return err
+	}
+	tx := &txOrmer{o}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// NewRepository creates a BaseRepository for the table of the instance's model, bound to the ormer when
+// given, ex: the transaction of WithTx, that its writes then join instead of beginning their own
+func NewRepository(table string, instance interface{}, ormer ...orm.Ormer) *BaseRepository {
+	r := &BaseRepository{}
+	r.Init(table, instance, ormer...)
+	return r
+}
+
+// withTx runs fn in a transaction, or in the transaction the repository is bound to, if any, so its writes
+// are committed and rolled back with the rest of the caller's
+func (r *BaseRepository) withTx(fn func(tx orm.Ormer) error) error {
+	if isTx(r.Orm) {
+		return fn(r.Orm)
+	}
+	return WithTx(fn, r.Orm.Driver().Name())
+}
+
+// txOrmer is the Ormer of a transaction begun by WithTx, so the repositories bound to it know they're in a
+// transaction, as the orm doesn't expose it
+type txOrmer struct {
+	orm.Ormer
+}
+
+// isTx tells if the ormer is a transaction of WithTx
+func isTx(o orm.Ormer) bool {
+	_, ok := o.(*txOrmer)
+	return ok
+}
+
+// inTx runs fn in a transaction, with the repository Orm replaced by the transaction. It must only be
+// used when the repository is not shared with other goroutines
+func (r *BaseRepository) inTx(fn func() error) error {
+	return r.withTx(func(tx orm.Ormer) error {
+		previous := r.Orm
+		r.Orm = tx
+		defer func() { r.Orm = previous }()
+		return fn()
+	})
+}
@@ -0,0 +1,61 @@
+package ngago
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/astaxie/beego/orm"
+)
+
+func TestWithTxRollsBackAllWrites(t *testing.T) {
+	resetBooks(t)
+	err := WithTx(func(tx orm.Ormer) error {
+		if _, err := NewRepository("author", Author{}, tx).Save(&Author{Name: "Le Guin"}); err != nil {
+			return err
+		}
+		// The title is already taken, so the second insert fails
+		_, err := NewRepository("book", Book{}, tx).Save(&Book{Title: "Dune"})
+		return err
+	})
+	if err == nil {
+		t.Fatal("expected the duplicated book to fail")
+	}
+	if count := countRows(t, "author"); count != 2 {
+		t.Errorf("expected the author to be rolled back, got %d authors", count)
+	}
+}
+
+func TestWithTxCommits(t *testing.T) {
+	resetBooks(t)
+	err := WithTx(func(tx orm.Ormer) error {
+		if _, err := NewRepository("author", Author{}, tx).Save(&Author{Name: "Le Guin"}); err != nil {
+			return err
+		}
+		_, err := NewRepository("book", Book{}, tx).Save(&Book{Title: "Earthsea"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authors, books := countRows(t, "author"), countRows(t, "book"); authors != 3 || books != 4 {
+		t.Errorf("expected 3 authors and 4 books, got %d and %d", authors, books)
+	}
+}
+
+func TestRepositoryTransactionsJoinTheBoundTransaction(t *testing.T) {
+	resetBooks(t)
+	errAbort := errors.New("abort")
+	err := WithTx(func(tx orm.Ormer) error {
+		books := NewRepository("book", Book{}, tx)
+		if _, err := books.Upsert(&Book{Id: 4, Title: "Children of Dune"}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatalf("expected the error of fn, got %v", err)
+	}
+	if count := countRows(t, "book"); count != 3 {
+		t.Errorf("expected the upsert to be rolled back, got %d books", count)
+	}
+}
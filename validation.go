@@ -0,0 +1,53 @@
+package ngago
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+Validator is implemented by entities that check their own business rules. Validate is called by Put,
+Patch, Post and Batch after decoding the body, and before saving the entity. When it returns an error,
+the request is rejected with a 422, with the messages of each field when it's a *ValidationError
+*/
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError is a validation failure, with a message for each invalid field, ex:
+// {"email": "is required"}, so forms can highlight the inputs to fix
+type ValidationError struct {
+	Fields map[string]string
+}
+
+// NewValidationError creates an empty ValidationError, to be filled with Add
+func NewValidationError() *ValidationError {
+	return &ValidationError{Fields: make(map[string]string)}
+}
+
+// Add records the message for an invalid field, replacing the previous one, if any
+func (e *ValidationError) Add(field, message string) {
+	e.Fields[field] = message
+}
+
+// OrNil returns the error if any field was added, or nil otherwise, ex: return errs.OrNil() from Validate
+func (e *ValidationError) OrNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for f := range e.Fields {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	messages := make([]string, len(fields))
+	for i, f := range fields {
+		messages[i] = fmt.Sprintf("%s %s", f, e.Fields[f])
+	}
+	return "invalid fields: " + strings.Join(messages, ", ")
+}
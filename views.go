@@ -0,0 +1,193 @@
+package ngago
+
+import (
+	"fmt"
+	"mime"
+	"reflect"
+	"strings"
+)
+
+/*
+Controllers can implement this interface to offer named representations (views) of their entities.
+Clients select a view with the _view param or with a profile parameter in the Accept header, ex:
+"Accept: application/json; profile=summary". Requests for views that are not declared are rejected
+with a 400. When no view is requested (or the view is "full"), entities are returned as they are
+*/
+type ViewController interface {
+	Views() map[string]View
+}
+
+// View transforms an entity into the representation returned to the client
+type View func(entity interface{}) interface{}
+
+// FieldsView returns a View that only includes the given JSON keys of the entity, in that order
+func FieldsView(keys ...string) View {
+	return func(entity interface{}) interface{} {
+		obj, ok := represent(entity).(*object)
+		if !ok {
+			return entity
+		}
+		view := newObject()
+		for _, k := range keys {
+			if v, ok := obj.Get(k); ok {
+				view.Set(k, v)
+			}
+		}
+		return view
+	}
+}
+
+/*
+Controllers can implement this interface to expose their entities with JSON keys that differ from the
+entity's own, ex: {"Uid": "userId"} to expose the Uid field as userId. The renaming applies to the
+entities returned, in single entities and in lists, after the requested view, and to the request
+bodies of Put, Post and Patch, that are expected to use the exposed names
+*/
+type FieldMapController interface {
+	FieldMap() map[string]string
+}
+
+// renameKeys renames the keys of a JSON object, returning any other data unchanged
+func renameKeys(data interface{}, names map[string]string) interface{} {
+	obj, ok := data.(*object)
+	if !ok {
+		return data
+	}
+	renamed := newObject()
+	for _, k := range obj.Keys() {
+		name, ok := names[k]
+		if !ok {
+			name = k
+		}
+		renamed.Set(name, obj.values[k])
+	}
+	return renamed
+}
+
+/*
+fieldsView returns a View with only the requested fields of the entities, ex: ["id", "name", "author.name"]
+-> {"id": 1, "name": "x", "author": {...}}. Fields are matched by the first element of their dotted path,
+by JSON key or field name, and the id is always included. Unknown fields are left out
+*/
+func (c *BaseRESTController) fieldsView(fields []string) View {
+	names := make(map[string]string)
+	if ctrl, ok := c.AppController.(FieldMapController); ok {
+		for k, name := range ctrl.FieldMap() {
+			names[name] = k
+		}
+	}
+	t := reflect.TypeOf(c.repo.NewInstance())
+	pk := primaryKey(t)
+	keys := []string{jsonName(pk)}
+	for _, path := range fields {
+		name := strings.TrimSpace(strings.Split(path, ".")[0])
+		if k, ok := names[name]; ok {
+			name = k
+		}
+		f, ok := findField(t, name)
+		if matches := jsonFields(t, []string{name}); len(matches) > 0 {
+			f, ok = matches[0], true
+		}
+		if ok && f.Name != pk.Name && jsonName(f) != "" {
+			keys = append(keys, jsonName(f))
+		}
+	}
+	return FieldsView(keys...)
+}
+
+// entityView returns the requested view followed by the controller's field renaming, or nil if there
+// is none of them
+func (c *BaseRESTController) entityView() View {
+	ctrl, ok := c.AppController.(FieldMapController)
+	if !ok || len(ctrl.FieldMap()) == 0 {
+		return c.view
+	}
+	view, names := c.view, ctrl.FieldMap()
+	return func(entity interface{}) interface{} {
+		if view != nil {
+			entity = view(entity)
+		}
+		return renameKeys(represent(entity), names)
+	}
+}
+
+func (c *BaseRESTController) parseView() View {
+	name := c.GetString("_view")
+	if name == "" {
+		name = acceptProfile(c.Ctx.Input.Header("Accept"))
+	}
+	if name == "" || name == "full" {
+		return nil
+	}
+	if ctrl, ok := c.AppController.(ViewController); ok {
+		if view, ok := ctrl.Views()[name]; ok {
+			return view
+		}
+	}
+	msg := fmt.Sprintf("Unknown view %#v for %s", name, c.EntityName())
+	c.log().Warn(msg)
+	c.SendError("400", msg)
+	return nil
+}
+
+func acceptProfile(accept string) string {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		if _, params, err := mime.ParseMediaType(mediaRange); err == nil && params["profile"] != "" {
+			return params["profile"]
+		}
+	}
+	return ""
+}
+
+/*
+Sanitizer is implemented by entities with fields that must never be sent to clients, ex: password hashes.
+SanitizeForOutput is called on every entity returned by the controller, single or in lists, before its
+view is applied, and should clear those fields. Entities of relations loaded into it are not sanitized
+*/
+type Sanitizer interface {
+	SanitizeForOutput()
+}
+
+// sanitize calls SanitizeForOutput on an entity, or on each entity of a pointer to a slice
+func sanitize(data interface{}) {
+	if s, ok := data.(Sanitizer); ok {
+		s.SanitizeForOutput()
+		return
+	}
+	items := reflect.Indirect(reflect.ValueOf(data))
+	if items.Kind() != reflect.Slice {
+		return
+	}
+	for i := 0; i < items.Len(); i++ {
+		item := items.Index(i)
+		if item.Kind() != reflect.Ptr {
+			item = item.Addr()
+		}
+		if s, ok := item.Interface().(Sanitizer); ok && !item.IsNil() {
+			s.SanitizeForOutput()
+		}
+	}
+}
+
+// applyView transforms an entity, or each entity of a pointer to a slice, with the requested view,
+// after sanitizing them
+func (c *BaseRESTController) applyView(data interface{}) interface{} {
+	sanitize(data)
+	view := c.entityView()
+	if view == nil {
+		return data
+	}
+	items := reflect.Indirect(reflect.ValueOf(data))
+	if items.Kind() != reflect.Slice {
+		return view(data)
+	}
+	list := make([]interface{}, items.Len())
+	for i := range list {
+		item := items.Index(i)
+		if item.Kind() != reflect.Ptr {
+			item = item.Addr()
+		}
+		list[i] = view(item.Interface())
+	}
+	return list
+}
@@ -0,0 +1,60 @@
+package ngago
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/astaxie/beego"
+)
+
+type Member struct {
+	Id           int64
+	Name         string
+	PasswordHash string `json:",omitempty"`
+}
+
+func (m *Member) SanitizeForOutput() {
+	m.PasswordHash = ""
+}
+
+var members = NewMemoryRepository("member", Member{})
+
+type MemberController struct {
+	BaseRESTController
+}
+
+func (c *MemberController) NewRepo() Repository {
+	return members
+}
+
+func (c *MemberController) Id(entity interface{}) int64 {
+	return entity.(*Member).Id
+}
+
+func init() {
+	beego.Router("/members", &MemberController{})
+	beego.Router("/members/:id", &MemberController{})
+}
+
+func TestSanitizedFieldsAreNotSent(t *testing.T) {
+	id, err := members.Save(&Member{Name: "ann", PasswordHash: "$2a$10$secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, url := range []string{"/members", "/members/" + strconv.FormatInt(id, 10)} {
+		w := request("GET", url, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", url, w.Code, w.Body.String())
+		}
+		if body := w.Body.String(); !strings.Contains(body, `"ann"`) || strings.Contains(body, "PasswordHash") {
+			t.Errorf("%s: expected the member without the password hash, got %s", url, body)
+		}
+	}
+	stored := &Member{}
+	members.Read(id, stored)
+	if stored.PasswordHash != "$2a$10$secret" {
+		t.Errorf("expected the stored member to keep the password hash, got %+v", stored)
+	}
+}
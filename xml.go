@@ -0,0 +1,151 @@
+package ngago
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// XMLContentType is the media type of the XML responses, sent by clients in the Accept header
+const XMLContentType = "application/xml"
+
+/*
+Controllers can implement this interface to serve XML to clients that ask for it in the Accept header,
+ex: "Accept: application/xml" or "text/xml". Entities are encoded with encoding/xml, so their xml tags
+are respected, and lists are wrapped in a <list> element. Other bodies, like views, renamed fields and
+error responses, are encoded from their JSON representation, as elements named after their keys, or as
+<field name="..."> elements for keys that are not valid XML names, in a <response> or <error> element.
+Requests accepting any media type are still served JSON
+*/
+type XMLController interface {
+	ServesXML() bool
+}
+
+// acceptsXML tells if the controller serves XML and the Accept header asks for it
+func acceptsXML(ctrl interface{}, accept string) bool {
+	if x, ok := ctrl.(XMLController); !ok || !x.ServesXML() {
+		return false
+	}
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(mediaRange)
+		if err == nil && (mediaType == XMLContentType || mediaType == "text/xml") {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeXML encodes data as an XML document, using root as the name of the element of generic data
+func encodeXML(root string, data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	v := reflect.ValueOf(data)
+	items := reflect.Indirect(v)
+	switch {
+	case items.Kind() == reflect.Struct && !isGeneric(data):
+		b, err := xml.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	case items.Kind() == reflect.Slice && items.Type().Elem().Kind() != reflect.Interface:
+		buf.WriteString("<list>")
+		for i := 0; i < items.Len(); i++ {
+			b, err := xml.Marshal(items.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(b)
+		}
+		buf.WriteString("</list>")
+	default:
+		generic := represent(data)
+		if _, ok := generic.([]interface{}); ok {
+			root = "list"
+		}
+		if err := writeXMLElement(&buf, root, generic); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func isGeneric(data interface{}) bool {
+	_, ok := data.(*object)
+	return ok
+}
+
+/*
+writeXMLElement writes a value of the generic representation as an element. Keys that are not valid XML
+names, as the ones of Summary and Aggregate can be, as they come from the client, are written as the name
+attribute of a <field> element instead, ex: <field name="total &amp; more">
+*/
+func writeXMLElement(buf *bytes.Buffer, name string, value interface{}) error {
+	if raw, ok := value.(json.RawMessage); ok {
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+	}
+	start := name
+	if !isXMLName(name) {
+		var attr bytes.Buffer
+		if err := xml.EscapeText(&attr, []byte(name)); err != nil {
+			return err
+		}
+		start, name = `field name="`+attr.String()+`"`, "field"
+	}
+	if value == nil {
+		fmt.Fprintf(buf, "<%s/>", start)
+		return nil
+	}
+	fmt.Fprintf(buf, "<%s>", start)
+	switch v := value.(type) {
+	case *object:
+		for _, k := range v.keys {
+			if err := writeXMLElement(buf, k, v.values[k]); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		obj, _ := represent(v).(*object)
+		for _, k := range obj.keys {
+			if err := writeXMLElement(buf, k, obj.values[k]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := writeXMLElement(buf, "item", item); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := xml.EscapeText(buf, []byte(fmt.Sprint(v))); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(buf, "</%s>", name)
+	return nil
+}
+
+// isXMLName tells if s can be used as the name of an element: a letter or "_" followed by letters, digits,
+// "_", "-" and ".". Names with ":", for namespaces, and the ones reserved, starting with "xml", are not
+func isXMLName(s string) bool {
+	if s == "" || strings.HasPrefix(strings.ToLower(s), "xml") {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case unicode.IsLetter(c) || c == '_':
+		case i > 0 && (unicode.IsDigit(c) || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package ngago
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestEncodeXMLWritesInvalidNamesAsAttributes(t *testing.T) {
+	obj := newObject()
+	obj.Set("total", 3)
+	obj.Set(`x><injected a="1"/><y`, 5)
+	obj.Set("xmlns", "reserved")
+	body, err := encodeXML("response", obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var elements []string
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid XML %s: %v", body, err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			elements = append(elements, start.Name.Local)
+		}
+	}
+	if got := strings.Join(elements, ","); got != "response,total,field,field" {
+		t.Errorf("expected the response, total and two field elements, got %s in %s", got, body)
+	}
+	if !strings.Contains(string(body), `<field name="x&gt;&lt;injected a=&#34;1&#34;/&gt;&lt;y">5</field>`) {
+		t.Errorf("expected the invalid key escaped in a name attribute, got %s", body)
+	}
+}